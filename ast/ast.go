@@ -3,6 +3,7 @@ package ast
 import (
 	"avm/token"
 	"bytes"
+	"math/big"
 )
 
 type Node interface {
@@ -12,6 +13,7 @@ type Node interface {
 
 type Statement interface {
 	Node
+	Pos() token.Position
 	statementNode()
 }
 
@@ -137,6 +139,22 @@ func (dl *DoubleLiteral) String() string {
 	return dl.Token.Literal
 }
 
+type BigDecimalLiteral struct {
+	Token        token.Token
+	DecimalValue *big.Rat
+}
+
+func (bd *BigDecimalLiteral) expressionNode() {}
+
+// TokenLiteral returns string token literal
+func (bd *BigDecimalLiteral) TokenLiteral() string {
+	return bd.Token.Literal
+}
+
+func (bd *BigDecimalLiteral) String() string {
+	return bd.Token.Literal
+}
+
 type InstructionStatement struct {
 	Token token.Token
 	Name  *Identifier
@@ -144,6 +162,11 @@ type InstructionStatement struct {
 
 func (is *InstructionStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (is *InstructionStatement) Pos() token.Position {
+	return is.Token.Pos
+}
+
 // TokenLiteral returns string token literal
 func (is *InstructionStatement) TokenLiteral() string {
 	return is.Token.Literal
@@ -165,6 +188,11 @@ type PushStatement struct {
 
 func (ls *PushStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (ls *PushStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
 // TokenLiteral returns string token literal
 func (ls *PushStatement) TokenLiteral() string {
 	return ls.Token.Literal
@@ -216,6 +244,11 @@ type AssertStatement struct {
 
 func (as *AssertStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (as *AssertStatement) Pos() token.Position {
+	return as.Token.Pos
+}
+
 func (as *AssertStatement) TokenLiteral() string {
 	return as.Token.Literal
 }
@@ -242,6 +275,11 @@ type AddStatement struct {
 
 func (as *AddStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (as *AddStatement) Pos() token.Position {
+	return as.Token.Pos
+}
+
 // TokenLiteral returns string token literal
 func (as *AddStatement) TokenLiteral() string {
 	return as.Token.Literal
@@ -262,6 +300,11 @@ type PopStatement struct {
 
 func (ps *PopStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (ps *PopStatement) Pos() token.Position {
+	return ps.Token.Pos
+}
+
 // TokenLiteral returns string token literal.
 func (ps *PopStatement) TokenLiteral() string {
 	return ps.Token.Literal
@@ -282,6 +325,11 @@ type DivStatement struct {
 
 func (do *DivStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (do *DivStatement) Pos() token.Position {
+	return do.Token.Pos
+}
+
 func (do *DivStatement) TokenLiteral() string {
 	return do.Token.Literal
 }
@@ -301,6 +349,11 @@ type MulStatement struct {
 
 func (mo *MulStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (mo *MulStatement) Pos() token.Position {
+	return mo.Token.Pos
+}
+
 // TokenLiteral returns string token literal
 func (mo *MulStatement) TokenLiteral() string {
 	return mo.Token.Literal
@@ -321,6 +374,11 @@ type ModStatement struct {
 
 func (mods *ModStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (mods *ModStatement) Pos() token.Position {
+	return mods.Token.Pos
+}
+
 // TokenLiteral returns string token literal
 func (mods *ModStatement) TokenLiteral() string {
 	return mods.Token.Literal
@@ -341,6 +399,11 @@ type DumpStatement struct {
 
 func (d *DumpStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (d *DumpStatement) Pos() token.Position {
+	return d.Token.Pos
+}
+
 // TokenLiteral returns string token literal.
 func (d *DumpStatement) TokenLiteral() string {
 	return d.Token.Literal
@@ -354,6 +417,429 @@ func (d *DumpStatement) String() string {
 	return out.String()
 }
 
+type SubStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (ss *SubStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ss *SubStatement) Pos() token.Position {
+	return ss.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ss *SubStatement) TokenLiteral() string {
+	return ss.Token.Literal
+}
+
+func (ss *SubStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ss.TokenLiteral())
+
+	return out.String()
+}
+
+type ClearStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (cs *ClearStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (cs *ClearStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (cs *ClearStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *ClearStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral())
+
+	return out.String()
+}
+
+type DupStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (ds *DupStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ds *DupStatement) Pos() token.Position {
+	return ds.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ds *DupStatement) TokenLiteral() string {
+	return ds.Token.Literal
+}
+
+func (ds *DupStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ds.TokenLiteral())
+
+	return out.String()
+}
+
+type SwapStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (sw *SwapStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (sw *SwapStatement) Pos() token.Position {
+	return sw.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (sw *SwapStatement) TokenLiteral() string {
+	return sw.Token.Literal
+}
+
+func (sw *SwapStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(sw.TokenLiteral())
+
+	return out.String()
+}
+
+type PrintStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (ps *PrintStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ps *PrintStatement) Pos() token.Position {
+	return ps.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ps *PrintStatement) TokenLiteral() string {
+	return ps.Token.Literal
+}
+
+func (ps *PrintStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ps.TokenLiteral())
+
+	return out.String()
+}
+
+type ExitStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (es *ExitStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (es *ExitStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (es *ExitStatement) TokenLiteral() string {
+	return es.Token.Literal
+}
+
+func (es *ExitStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(es.TokenLiteral())
+
+	return out.String()
+}
+
+// LabelStatement defines a label, e.g. loop:, naming the position of the
+// next instruction.
+type LabelStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (ls *LabelStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ls *LabelStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ls *LabelStatement) TokenLiteral() string {
+	return ls.Token.Literal
+}
+
+func (ls *LabelStatement) String() string {
+	return ls.Name.String() + token.COLON
+}
+
+// JumpStatement is one of jmp, jz, jnz, jlt and jgt, given by the type of its
+// token, followed by the label to jump to.
+type JumpStatement struct {
+	Token token.Token
+	Label *Identifier
+}
+
+func (js *JumpStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (js *JumpStatement) Pos() token.Position {
+	return js.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (js *JumpStatement) TokenLiteral() string {
+	return js.Token.Literal
+}
+
+func (js *JumpStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(js.TokenLiteral() + " ")
+	out.WriteString(js.Label.String())
+
+	return out.String()
+}
+
+// CallStatement calls the subroutine starting at its label.
+type CallStatement struct {
+	Token token.Token
+	Label *Identifier
+}
+
+func (cs *CallStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (cs *CallStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (cs *CallStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *CallStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Label.String())
+
+	return out.String()
+}
+
+// RetStatement returns from the current subroutine.
+type RetStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (rs *RetStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (rs *RetStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (rs *RetStatement) TokenLiteral() string {
+	return rs.Token.Literal
+}
+
+func (rs *RetStatement) String() string {
+	return rs.TokenLiteral()
+}
+
+// StoreStatement pops the value at the top of the stack into a variable.
+type StoreStatement struct {
+	Token    token.Token
+	Variable *Identifier
+}
+
+func (ss *StoreStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ss *StoreStatement) Pos() token.Position {
+	return ss.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ss *StoreStatement) TokenLiteral() string {
+	return ss.Token.Literal
+}
+
+func (ss *StoreStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ss.TokenLiteral() + " ")
+	out.WriteString(ss.Variable.String())
+
+	return out.String()
+}
+
+// LoadStatement pushes a copy of the value of a variable.
+type LoadStatement struct {
+	Token    token.Token
+	Variable *Identifier
+}
+
+func (ls *LoadStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ls *LoadStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ls *LoadStatement) TokenLiteral() string {
+	return ls.Token.Literal
+}
+
+func (ls *LoadStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ls.TokenLiteral() + " ")
+	out.WriteString(ls.Variable.String())
+
+	return out.String()
+}
+
+// StackStatement is one of over, rot, pick, roll, drop and depth, given by the
+// type of its token. Count is the operand of pick, roll and drop, nil for the
+// others.
+type StackStatement struct {
+	Token token.Token
+	Count *IntegerLiteral
+}
+
+func (ss *StackStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ss *StackStatement) Pos() token.Position {
+	return ss.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ss *StackStatement) TokenLiteral() string {
+	return ss.Token.Literal
+}
+
+func (ss *StackStatement) String() string {
+	if ss.Count == nil {
+		return ss.TokenLiteral()
+	}
+
+	return ss.TokenLiteral() + " " + ss.Count.String()
+}
+
+// CastStatement converts the value at the top of the stack to Type.
+type CastStatement struct {
+	Token token.Token
+	Type  *Identifier
+}
+
+func (cs *CastStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (cs *CastStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (cs *CastStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *CastStatement) String() string {
+	return cs.TokenLiteral() + " " + cs.Type.String()
+}
+
+// MathStatement is one of neg, abs, min, max, pow, sqrt, exp, log, sin and
+// cos, given by the type of its token.
+type MathStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (ms *MathStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (ms *MathStatement) Pos() token.Position {
+	return ms.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (ms *MathStatement) TokenLiteral() string {
+	return ms.Token.Literal
+}
+
+func (ms *MathStatement) String() string {
+	return ms.TokenLiteral()
+}
+
+// BitwiseStatement is one of and, or, xor, not, shl, shr and sar, given by
+// the type of its token.
+type BitwiseStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (bs *BitwiseStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (bs *BitwiseStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (bs *BitwiseStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+func (bs *BitwiseStatement) String() string {
+	return bs.TokenLiteral()
+}
+
+// CompareStatement is one of eq, neq, lt, le, gt and ge, given by the type of
+// its token.
+type CompareStatement struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (cs *CompareStatement) statementNode() {}
+
+// Pos returns the position of the statement in the source.
+func (cs *CompareStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+// TokenLiteral returns string token literal.
+func (cs *CompareStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *CompareStatement) String() string {
+	return cs.TokenLiteral()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -361,6 +847,11 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode() {}
 
+// Pos returns the position of the statement in the source.
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
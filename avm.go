@@ -0,0 +1,163 @@
+// Package avm runs AbstractVM programs in-process.
+//
+// A VM keeps its stack and its variables between calls to Run and Exec, so a
+// program can be fed instruction by instruction. Reset empties them.
+package avm
+
+import (
+	"avm/evaluator"
+	"avm/parser"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Value is a typed value on the stack.
+type Value = evaluator.Value
+
+// HaltError is returned when a program is canceled or reaches a limit.
+type HaltError = evaluator.HaltError
+
+// ErrInstructionLimit is wrapped in the HaltError of a program exceeding its
+// instruction limit.
+var ErrInstructionLimit = evaluator.ErrInstructionLimit
+
+// OverflowMode defines how arithmetic results that do not fit in their type
+// are handled.
+type OverflowMode = evaluator.ArithmeticMode
+
+const (
+	// CheckedOverflow fails the instruction with an overflow error.
+	CheckedOverflow = evaluator.CheckedArithmetic
+	// WrappingOverflow wraps integers around their range.
+	WrappingOverflow = evaluator.WrappingArithmetic
+	// SaturatingOverflow clamps results to the bounds of their type.
+	SaturatingOverflow = evaluator.SaturatingArithmetic
+)
+
+// VM is an AbstractVM instance.
+type VM struct {
+	vm *evaluator.VM
+}
+
+// Option configures a VM.
+type Option func(*VM)
+
+// WithStdout sets the writer receiving the output of dump and print.
+func WithStdout(w io.Writer) Option {
+	return func(m *VM) {
+		m.vm.Stdout = w
+	}
+}
+
+// WithStderr sets the writer receiving debug traces, see WithDebug.
+func WithStderr(w io.Writer) Option {
+	return func(m *VM) {
+		m.vm.Stderr = w
+	}
+}
+
+// WithDebug writes a line to the stderr writer before each executed
+// instruction, with its position and the depth of the stack.
+func WithDebug(debug bool) Option {
+	return func(m *VM) {
+		m.vm.Debug = debug
+	}
+}
+
+// WithTrace writes a JSON line describing each executed instruction to w,
+// see evaluator.TraceRecord.
+func WithTrace(w io.Writer) Option {
+	return func(m *VM) {
+		m.vm.Trace = w
+	}
+}
+
+// WithMaxStackDepth limits the number of values on the stack, 0 means
+// unlimited. The default is evaluator.DefaultMaxDepth.
+func WithMaxStackDepth(n int) Option {
+	return func(m *VM) {
+		m.vm.Stack.SetMaxDepth(n)
+	}
+}
+
+// WithOverflowMode sets how arithmetic overflows are handled. The default is
+// CheckedOverflow.
+func WithOverflowMode(mode OverflowMode) Option {
+	return func(m *VM) {
+		m.vm.Mode = mode
+	}
+}
+
+// WithInstructionLimit limits the number of instructions executed by each
+// call to Run or Exec, 0 means unlimited.
+func WithInstructionLimit(n int) Option {
+	return func(m *VM) {
+		m.vm.MaxInstructions = n
+	}
+}
+
+// WithMaxCallDepth limits the number of nested calls, 0 means unlimited.
+// The default is evaluator.DefaultMaxCallDepth.
+func WithMaxCallDepth(n int) Option {
+	return func(m *VM) {
+		m.vm.MaxCallDepth = n
+	}
+}
+
+// WithTimeout limits the wall-clock time of each call to Run or Exec, 0
+// means unlimited.
+func WithTimeout(d time.Duration) Option {
+	return func(m *VM) {
+		m.vm.Timeout = d
+	}
+}
+
+// New returns a VM with an empty stack writing to os.Stdout and os.Stderr.
+func New(opts ...Option) *VM {
+	m := &VM{vm: evaluator.NewVM(evaluator.NewStack())}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Run parses the program read from r and evaluates it. An exit instruction
+// stops the program without error. When ctx is done or a limit is reached,
+// the program is stopped with an *HaltError.
+func (m *VM) Run(ctx context.Context, r io.Reader) error {
+	p, err := parser.NewParserFromReader(r)
+	if err != nil {
+		return err
+	}
+
+	pg, err := p.ParseProgram()
+	if err != nil {
+		return err
+	}
+
+	_, err = m.vm.EvalContext(ctx, pg)
+	if errors.Is(err, evaluator.ErrExit) {
+		return nil
+	}
+
+	return err
+}
+
+// Exec evaluates the instructions in src.
+func (m *VM) Exec(src string) error {
+	return m.Run(context.Background(), strings.NewReader(src))
+}
+
+// Stack returns the values on the stack, from the top to the bottom.
+func (m *VM) Stack() []Value {
+	return m.vm.Stack.Values()
+}
+
+// Reset empties the stack and forgets every variable.
+func (m *VM) Reset() {
+	m.vm.Reset()
+}
@@ -0,0 +1,90 @@
+package avm
+
+import (
+	"avm/evaluator"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	m := New(WithStdout(&out))
+
+	err := m.Run(context.Background(), strings.NewReader("push int8(72)\nprint\npush int32(42)\nexit\npush int32(1)"))
+	require.NoError(t, err)
+	require.Equal(t, "H", out.String())
+	require.Equal(t, []Value{evaluator.NewInt32Value(42), evaluator.NewInt8Value(72)}, m.Stack())
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m := New()
+	err := m.Run(ctx, strings.NewReader("push int8(1)"))
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Empty(t, m.Stack())
+
+	// the loop only ends when the timeout expires
+	m = New(WithTimeout(time.Millisecond))
+	err = m.Exec("loop:\njmp loop")
+	var herr *HaltError
+	require.True(t, errors.As(err, &herr))
+	require.Equal(t, context.DeadlineExceeded, herr.Err)
+}
+
+func TestExec(t *testing.T) {
+	m := New()
+	require.NoError(t, m.Exec("push int32(40)"))
+	require.NoError(t, m.Exec("push int32(2)\nadd"))
+	require.Equal(t, []Value{evaluator.NewInt32Value(42)}, m.Stack())
+
+	require.NoError(t, m.Exec("store answer\nload answer"))
+	m.Reset()
+	require.Empty(t, m.Stack())
+	require.True(t, errors.Is(m.Exec("load answer"), evaluator.ErrUndefinedVariable))
+
+	require.Error(t, m.Exec("push int32("))
+	require.Error(t, m.Exec("pop"))
+}
+
+func TestOptions(t *testing.T) {
+	m := New(WithMaxStackDepth(2))
+	require.NoError(t, m.Exec("push int8(1)\npush int8(2)"))
+	var overflow *evaluator.StackOverflowError
+	require.True(t, errors.As(m.Exec("push int8(3)"), &overflow))
+	require.Len(t, m.Stack(), 2)
+
+	m = New(WithInstructionLimit(2))
+	err := m.Exec("push int8(1)\npush int8(2)\npush int8(3)")
+	require.True(t, errors.Is(err, ErrInstructionLimit))
+	require.Len(t, m.Stack(), 2)
+
+	m = New(WithMaxCallDepth(2))
+	require.NoError(t, m.Exec("call a\nexit\na: call b\nret\nb: ret"))
+	require.True(t, errors.Is(m.Exec("call a\nexit\na: call b\nret\nb: call c\nret\nc: ret"), evaluator.ErrCallDepth))
+
+	m = New(WithOverflowMode(WrappingOverflow))
+	require.NoError(t, m.Exec("push int8(127)\npush int8(1)\nadd"))
+	require.Equal(t, []Value{evaluator.NewInt8Value(-128)}, m.Stack())
+
+	m = New()
+	require.Error(t, m.Exec("push int8(127)\npush int8(1)\nadd"))
+	require.Equal(t, []Value{evaluator.NewInt8Value(1), evaluator.NewInt8Value(127)}, m.Stack())
+
+	var trace bytes.Buffer
+	m = New(WithTrace(&trace))
+	require.NoError(t, m.Exec("push int8(1)\npop"))
+	require.Equal(t, 2, strings.Count(trace.String(), "\n"))
+
+	var stderr bytes.Buffer
+	m = New(WithStderr(&stderr), WithDebug(true))
+	require.NoError(t, m.Exec("push int8(1)\npop"))
+	require.Equal(t, "debug: 1:1: push int8(1) (stack depth 0)\ndebug: 2:1: pop (stack depth 1)\n", stderr.String())
+}
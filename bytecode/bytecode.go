@@ -0,0 +1,352 @@
+// Package bytecode compiles programs to a compact binary form.
+//
+// A compiled program is a list of instructions, each made of an opcode and,
+// for push and assert, the index of a typed constant, for jumps and calls the
+// index of a label, for store and load the index of a variable name, for cast
+// a type and for pick, roll and drop a count. The constants are evaluated
+// once at compile time, so running a compiled program does not lex nor parse
+// any text.
+//
+// Program.Executable returns the code run by evaluator.VM.RunCode, which
+// dispatches on the opcode of each instruction. Program.AST converts the
+// instructions back to statements, for the tools working on statements such
+// as the debugger.
+package bytecode
+
+import (
+	"avm/ast"
+	"avm/evaluator"
+	"avm/token"
+	"fmt"
+	"strconv"
+)
+
+// Instruction is a single compiled instruction.
+type Instruction = evaluator.Instruction
+
+// Label names the instruction a jump or a call goes to.
+type Label = evaluator.Label
+
+// Program is a compiled program.
+type Program struct {
+	Filename  string
+	Constants []evaluator.Value
+	Labels    []Label
+	Variables []string
+	Code      []Instruction
+}
+
+type compiler struct {
+	prog   *Program
+	consts map[string]int
+	labels map[string]int // index of each label in prog.Labels
+	vars   map[string]int // index of each variable in prog.Variables
+	vm     *evaluator.VM
+}
+
+// Compile compiles pg to bytecode. The operands of push and assert are
+// evaluated, so an operand that overflows its type is a compile error.
+func Compile(pg *ast.Program) (*Program, error) {
+	c := &compiler{
+		prog:   &Program{},
+		consts: make(map[string]int),
+		labels: make(map[string]int),
+		vars:   make(map[string]int),
+		vm:     evaluator.NewVM(evaluator.NewStack()),
+	}
+
+	if _, err := evaluator.ResolveLabels(pg.Statements); err != nil {
+		return nil, err
+	}
+
+	// labels are not instructions, the instruction following a label is
+	// found by counting the other statements before it.
+	pc := 0
+	for _, stmt := range pg.Statements {
+		if l, ok := stmt.(*ast.LabelStatement); ok {
+			c.labels[l.Name.Value] = len(c.prog.Labels)
+			c.prog.Labels = append(c.prog.Labels, Label{Name: l.Name.Value, PC: pc})
+			continue
+		}
+		pc++
+	}
+
+	for _, stmt := range pg.Statements {
+		if err := c.compile(stmt); err != nil {
+			return nil, fmt.Errorf("%s: %w", stmt.Pos(), err)
+		}
+	}
+
+	if len(pg.Statements) > 0 {
+		c.prog.Filename = pg.Statements[0].Pos().Filename
+	}
+
+	return c.prog, nil
+}
+
+func (c *compiler) compile(stmt ast.Statement) error {
+	switch s := stmt.(type) {
+	case *ast.PushStatement:
+		return c.emitOperand(OpPush, stmt, s.Name.String(), s.Value)
+	case *ast.AssertStatement:
+		return c.emitOperand(OpAssert, stmt, s.Name.String(), s.Value)
+	case *ast.PopStatement:
+		c.emit(OpPop, 0, stmt)
+	case *ast.DumpStatement:
+		c.emit(OpDump, 0, stmt)
+	case *ast.ClearStatement:
+		c.emit(OpClear, 0, stmt)
+	case *ast.DupStatement:
+		c.emit(OpDup, 0, stmt)
+	case *ast.SwapStatement:
+		c.emit(OpSwap, 0, stmt)
+	case *ast.AddStatement:
+		c.emit(OpAdd, 0, stmt)
+	case *ast.SubStatement:
+		c.emit(OpSub, 0, stmt)
+	case *ast.MulStatement:
+		c.emit(OpMul, 0, stmt)
+	case *ast.DivStatement:
+		c.emit(OpDiv, 0, stmt)
+	case *ast.ModStatement:
+		c.emit(OpMod, 0, stmt)
+	case *ast.PrintStatement:
+		c.emit(OpPrint, 0, stmt)
+	case *ast.ExitStatement:
+		c.emit(OpExit, 0, stmt)
+	case *ast.CompareStatement:
+		c.emit(compareOpcodes[s.Token.Type], 0, stmt)
+	case *ast.StackStatement:
+		n := 0
+		if s.Count != nil {
+			n = int(s.Count.IntValue)
+		}
+		c.emit(stackOpcodes[s.Token.Type], n, stmt)
+	case *ast.CastStatement:
+		t, ok := evaluator.LookupType(s.Type.Value)
+		if !ok {
+			return fmt.Errorf("error: unknown type %s", s.Type.Value)
+		}
+		c.emit(OpCast, int(t), stmt)
+	case *ast.MathStatement:
+		c.emit(mathOpcodes[s.Token.Type], 0, stmt)
+	case *ast.BitwiseStatement:
+		c.emit(bitwiseOpcodes[s.Token.Type], 0, stmt)
+	case *ast.LabelStatement:
+	case *ast.JumpStatement:
+		c.emit(jumpOpcodes[s.Token.Type], c.labels[s.Label.Value], stmt)
+	case *ast.CallStatement:
+		c.emit(OpCall, c.labels[s.Label.Value], stmt)
+	case *ast.RetStatement:
+		c.emit(OpRet, 0, stmt)
+	case *ast.StoreStatement:
+		c.emit(OpStore, c.variable(s.Variable.Value), stmt)
+	case *ast.LoadStatement:
+		c.emit(OpLoad, c.variable(s.Variable.Value), stmt)
+	default:
+		return fmt.Errorf("error: cannot compile %s", stmt)
+	}
+
+	return nil
+}
+
+func (c *compiler) emit(op Opcode, operand int, stmt ast.Statement) {
+	c.prog.Code = append(c.prog.Code, Instruction{Op: op, Operand: operand, Pos: stmt.Pos()})
+}
+
+// variable returns the index of a variable name, adding it the first time.
+func (c *compiler) variable(name string) int {
+	i, ok := c.vars[name]
+	if !ok {
+		i = len(c.prog.Variables)
+		c.prog.Variables = append(c.prog.Variables, name)
+		c.vars[name] = i
+	}
+
+	return i
+}
+
+// emitOperand evaluates the operand of an instruction and adds it to the
+// constants. Identical constants are stored once.
+func (c *compiler) emitOperand(op Opcode, stmt ast.Statement, name string, expr ast.Expression) error {
+	v, err := c.vm.EvalOperand(name, expr)
+	if err != nil {
+		return err
+	}
+
+	// the literal of a bigdecimal can be rounded, its fraction is exact
+	key := fmt.Sprintf("%s:%s", v.Type, v.Literal())
+	if v.Type == evaluator.BigDecimalValue {
+		key = fmt.Sprintf("%s:%s", v.Type, v.Decimal().RatString())
+	}
+	i, ok := c.consts[key]
+	if !ok {
+		i = len(c.prog.Constants)
+		c.prog.Constants = append(c.prog.Constants, v)
+		c.consts[key] = i
+	}
+
+	c.emit(op, i, stmt)
+	return nil
+}
+
+// Executable returns the code of the program, run by evaluator.VM.RunCode.
+func (p *Program) Executable() *evaluator.Code {
+	return &evaluator.Code{
+		Filename:     p.Filename,
+		Constants:    p.Constants,
+		Labels:       p.Labels,
+		Variables:    p.Variables,
+		Instructions: p.Code,
+	}
+}
+
+// AST returns the statements the program was compiled from, e.g. to debug
+// the program statement by statement. It fails on an unknown opcode.
+func (p *Program) AST() (*ast.Program, error) {
+	labels := p.labelsAt()
+	pg := &ast.Program{Statements: make([]ast.Statement, 0, len(p.Code)+len(p.Labels))}
+	for pc := 0; pc <= len(p.Code); pc++ {
+		for _, l := range labels[pc] {
+			pos := token.Position{Filename: p.Filename}
+			if pc < len(p.Code) {
+				pos = p.statementPos(p.Code[pc])
+			}
+			tok := token.Token{Type: token.IDENT, Literal: l.Name, Pos: pos}
+			pg.Statements = append(pg.Statements, &ast.LabelStatement{Token: tok, Name: &ast.Identifier{Token: tok, Value: l.Name}})
+		}
+
+		if pc < len(p.Code) {
+			stmt, err := p.statement(p.Code[pc])
+			if err != nil {
+				return nil, err
+			}
+			pg.Statements = append(pg.Statements, stmt)
+		}
+	}
+
+	return pg, nil
+}
+
+// labelsAt returns the labels defined before each instruction.
+func (p *Program) labelsAt() map[int][]Label {
+	labels := make(map[int][]Label)
+	for _, l := range p.Labels {
+		labels[l.PC] = append(labels[l.PC], l)
+	}
+
+	return labels
+}
+
+func (p *Program) statementPos(ins Instruction) token.Position {
+	pos := ins.Pos
+	pos.Filename = p.Filename
+	return pos
+}
+
+func (p *Program) statement(ins Instruction) (ast.Statement, error) {
+	pos := p.statementPos(ins)
+	tok := token.Token{Type: token.TokenType(ins.Op.String()), Literal: ins.Op.String(), Pos: pos}
+	name := &ast.Identifier{Token: tok, Value: tok.Literal}
+
+	if ins.Op.HasLabel() {
+		label := p.Labels[ins.Operand].Name
+		ltok := token.Token{Type: token.IDENT, Literal: label, Pos: pos}
+		ident := &ast.Identifier{Token: ltok, Value: label}
+		if ins.Op == OpCall {
+			return &ast.CallStatement{Token: tok, Label: ident}, nil
+		}
+		return &ast.JumpStatement{Token: tok, Label: ident}, nil
+	}
+
+	if ins.Op.HasVariable() {
+		variable := p.Variables[ins.Operand]
+		vtok := token.Token{Type: token.IDENT, Literal: variable, Pos: pos}
+		ident := &ast.Identifier{Token: vtok, Value: variable}
+		if ins.Op == OpStore {
+			return &ast.StoreStatement{Token: tok, Variable: ident}, nil
+		}
+		return &ast.LoadStatement{Token: tok, Variable: ident}, nil
+	}
+
+	if ins.Op.HasType() {
+		typ := evaluator.ValueType(ins.Operand).String()
+		ttok := token.Token{Type: token.TokenType(typ), Literal: typ, Pos: pos}
+		return &ast.CastStatement{Token: tok, Type: &ast.Identifier{Token: ttok, Value: typ}}, nil
+	}
+
+	if ins.Op >= OpOver && ins.Op <= OpDepth {
+		stmt := &ast.StackStatement{Token: tok}
+		if ins.Op.HasCount() {
+			n := strconv.Itoa(ins.Operand)
+			ctok := token.Token{Type: token.INT, Literal: n, Pos: pos}
+			stmt.Count = &ast.IntegerLiteral{Token: ctok, IntValue: int32(ins.Operand)}
+		}
+		return stmt, nil
+	}
+
+	switch ins.Op {
+	case OpPush:
+		name, value := operand(p.Constants[ins.Operand], pos)
+		return &ast.PushStatement{Token: tok, Name: name, Value: value}, nil
+	case OpAssert:
+		name, value := operand(p.Constants[ins.Operand], pos)
+		return &ast.AssertStatement{Token: tok, Name: name, Value: value}, nil
+	case OpPop:
+		return &ast.PopStatement{Token: tok, Name: name}, nil
+	case OpDump:
+		return &ast.DumpStatement{Token: tok, Name: name}, nil
+	case OpClear:
+		return &ast.ClearStatement{Token: tok, Name: name}, nil
+	case OpDup:
+		return &ast.DupStatement{Token: tok, Name: name}, nil
+	case OpSwap:
+		return &ast.SwapStatement{Token: tok, Name: name}, nil
+	case OpAdd:
+		return &ast.AddStatement{Token: tok, Name: name}, nil
+	case OpSub:
+		return &ast.SubStatement{Token: tok, Name: name}, nil
+	case OpMul:
+		return &ast.MulStatement{Token: tok, Name: name}, nil
+	case OpDiv:
+		return &ast.DivStatement{Token: tok, Name: name}, nil
+	case OpMod:
+		return &ast.ModStatement{Token: tok, Name: name}, nil
+	case OpPrint:
+		return &ast.PrintStatement{Token: tok, Name: name}, nil
+	case OpRet:
+		return &ast.RetStatement{Token: tok, Name: name}, nil
+	case OpEq, OpNeq, OpLt, OpLe, OpGt, OpGe:
+		return &ast.CompareStatement{Token: tok, Name: name}, nil
+	case OpNeg, OpAbs, OpMin, OpMax, OpPow, OpSqrt, OpExp, OpLog, OpSin, OpCos:
+		return &ast.MathStatement{Token: tok, Name: name}, nil
+	case OpAnd, OpOr, OpXor, OpNot, OpShl, OpShr, OpSar:
+		return &ast.BitwiseStatement{Token: tok, Name: name}, nil
+	case OpExit:
+		return &ast.ExitStatement{Token: tok, Name: name}, nil
+	}
+
+	return nil, fmt.Errorf("error: unknown opcode %d", byte(ins.Op))
+}
+
+// operand returns the type and the literal of a constant.
+func operand(v evaluator.Value, pos token.Position) (*ast.Identifier, ast.Expression) {
+	typ := v.Type.String()
+	name := &ast.Identifier{Token: token.Token{Type: token.TokenType(typ), Literal: typ, Pos: pos}, Value: typ}
+	tok := token.Token{Type: token.TokenType(typ), Literal: v.Literal(), Pos: pos}
+
+	switch v.Type {
+	case evaluator.CharValue:
+		return name, &ast.ByteLiteral{Token: tok, ByteValue: int8(v.Int())}
+	case evaluator.ShortValue:
+		return name, &ast.ShortLiteral{Token: tok, ShortValue: int16(v.Int())}
+	case evaluator.IntegerValue:
+		return name, &ast.IntegerLiteral{Token: tok, IntValue: int32(v.Int())}
+	case evaluator.FloatValue:
+		return name, &ast.FloatLiteral{Token: tok, FloatValue: float32(v.Float())}
+	case evaluator.DoubleValue:
+		return name, &ast.DoubleLiteral{Token: tok, DoubleValue: v.Float()}
+	}
+
+	return name, &ast.BigDecimalLiteral{Token: tok, DecimalValue: v.Decimal()}
+}
@@ -0,0 +1,427 @@
+package bytecode
+
+import (
+	"avm/evaluator"
+	"avm/parser"
+	"avm/token"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func compile(t *testing.T, input string) *Program {
+	pg, err := parser.NewParser(input).ParseProgram()
+	require.NoError(t, err)
+
+	prog, err := Compile(pg)
+	require.NoError(t, err)
+	return prog
+}
+
+// statements returns the statements of a program, written back to source.
+func statements(t *testing.T, prog *Program) string {
+	pg, err := prog.AST()
+	require.NoError(t, err)
+	return pg.String()
+}
+
+// run runs the instructions of a program on a new VM.
+func run(prog *Program) (*evaluator.VM, error) {
+	vm := evaluator.NewVM(evaluator.NewStack())
+	_, err := vm.RunCode(context.Background(), prog.Executable())
+	return vm, err
+}
+
+func TestCompile(t *testing.T) {
+	prog := compile(t, "push int32(2 * (5 + 10))\npush int8(-1)\n; comment\npush int32(30)\nadd\nassert int32(29)\nexit")
+
+	require.Equal(t, []evaluator.Value{
+		evaluator.NewInt32Value(30),
+		evaluator.NewInt8Value(-1),
+		evaluator.NewInt32Value(29),
+	}, prog.Constants)
+
+	require.Equal(t, []Instruction{
+		{Op: OpPush, Operand: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Op: OpPush, Operand: 1, Pos: token.Position{Line: 2, Column: 1}},
+		{Op: OpPush, Operand: 0, Pos: token.Position{Line: 4, Column: 1}},
+		{Op: OpAdd, Pos: token.Position{Line: 5, Column: 1}},
+		{Op: OpAssert, Operand: 2, Pos: token.Position{Line: 6, Column: 1}},
+		{Op: OpExit, Pos: token.Position{Line: 7, Column: 1}},
+	}, prog.Code)
+}
+
+func TestCompileError(t *testing.T) {
+	pg, err := parser.NewParser("pop\npush int32(2147483647 + 1)").ParseProgram()
+	require.NoError(t, err)
+
+	_, err = Compile(pg)
+	require.Error(t, err)
+
+	var oErr *evaluator.OverflowError
+	require.True(t, errors.As(err, &oErr))
+	require.Contains(t, err.Error(), "2:1: ")
+}
+
+func TestEncodeDecode(t *testing.T) {
+	input := `push int8(-128)
+push int16(300)
+push int32(70000)
+push float(44.55)
+push double(42.42)
+push bigdecimal(0.1)
+assert bigdecimal(0.1)
+pop
+dump
+clear
+push int8(72)
+dup
+swap
+print
+sub
+mul
+div
+mod
+eq
+neq
+lt
+le
+gt
+ge
+neg
+abs
+min
+max
+pow
+sqrt
+exp
+log
+sin
+cos
+and
+or
+xor
+not
+shl
+shr
+sar
+cast int16
+over
+rot
+pick 3
+roll 2
+drop 1
+depth
+;;`
+	prog := compile(t, input)
+	prog.Filename = "test.avm"
+
+	var buf bytes.Buffer
+	require.NoError(t, prog.Encode(&buf))
+	require.Equal(t, Magic, buf.String()[:len(Magic)])
+
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, prog.Filename, decoded.Filename)
+	require.Equal(t, prog.Code, decoded.Code)
+	require.Len(t, decoded.Constants, len(prog.Constants))
+	for i, v := range prog.Constants {
+		require.Equal(t, v.String(), decoded.Constants[i].String())
+		require.Equal(t, v.Type, decoded.Constants[i].Type)
+	}
+
+	require.Equal(t, 0, big.NewRat(1, 10).Cmp(decoded.Constants[5].Decimal()))
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, compile(t, "push int8(1)\ndump").Encode(&buf))
+	data := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrBadMagic},
+		{"source file", []byte("push int8(1)"), ErrBadMagic},
+		{"truncated", data[:len(Magic)+1], io.ErrUnexpectedEOF},
+		{"corrupted", corrupt(data, len(data)-6), ErrChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.data))
+			require.Equal(t, tt.want, err)
+		})
+	}
+
+	_, err := Decode(bytes.NewReader(rehash(corrupt(data, len(Magic)+1))))
+	require.EqualError(t, err, fmt.Sprintf("error: unsupported compiled file version %d, expected %d", Version^1, Version))
+}
+
+// corrupt returns a copy of data with the byte at i changed.
+func corrupt(data []byte, i int) []byte {
+	b := append([]byte(nil), data...)
+	b[i] ^= 1
+	return b
+}
+
+// rehash fixes the checksum of a modified program.
+func rehash(data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-4])
+	_ = binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(data[:len(data)-4]))
+	return buf.Bytes()
+}
+
+func TestRunCompiled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bytecode")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pg, err := parser.ParseFile("../f.avm")
+	require.NoError(t, err)
+
+	prog, err := Compile(pg)
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "f.avmc")
+	require.NoError(t, prog.WriteFile(filename))
+
+	prog, err = ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "../f.avm", prog.Filename)
+
+	ast, err := prog.AST()
+	require.NoError(t, err)
+	require.Equal(t, pg.String(), ast.String())
+	require.Equal(t, pg.Statements[0].Pos(), ast.Statements[0].Pos())
+
+	var out bytes.Buffer
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.Stdout = &out
+	_, err = vm.RunCode(context.Background(), prog.Executable())
+	require.Equal(t, evaluator.ErrExit, err)
+	require.Equal(t, "{42 int32}\n{42.42 double}\n{3341.25 float}\n\n", out.String())
+}
+
+func TestRunCodeError(t *testing.T) {
+	prog := compile(t, "push int8(1)\nloop:\npush int8(0)\ndiv\njmp loop")
+	prog.Filename = "f.avm"
+
+	vm, err := run(prog)
+	var rerr *evaluator.RuntimeError
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, token.Position{Filename: "f.avm", Line: 4, Column: 1}, rerr.Pos)
+	require.Equal(t, "div", rerr.Instruction)
+	require.Equal(t, "[{0 int8} {0 int8}]", fmt.Sprint(vm.Stack.Values()))
+
+	prog = compile(t, "loop: jmp loop")
+	vm = evaluator.NewVM(evaluator.NewStack())
+	vm.MaxInstructions = 100
+	_, err = vm.RunCode(context.Background(), prog.Executable())
+	var halt *evaluator.HaltError
+	require.True(t, errors.As(err, &halt))
+	require.Equal(t, 100, halt.Executed)
+	require.True(t, errors.Is(err, evaluator.ErrInstructionLimit))
+}
+
+func TestUnknownOpcode(t *testing.T) {
+	prog := compile(t, "push int8(1)\ndump")
+	prog.Code[1].Op = Opcode(0xff)
+
+	_, err := prog.AST()
+	require.EqualError(t, err, "error: unknown opcode 255")
+
+	_, err = run(prog)
+	var rerr *evaluator.RuntimeError
+	require.True(t, errors.As(err, &rerr))
+	require.EqualError(t, rerr.Err, "error: unknown opcode 255")
+}
+
+func TestDisassemble(t *testing.T) {
+	src := "push int32(33)\n  push bigdecimal(0.5)\n\nadd\nexit"
+	prog := compile(t, src)
+
+	var out bytes.Buffer
+	require.NoError(t, prog.Disassemble(&out, []byte(src)))
+	require.Equal(t, `; 4 instructions, 2 constants
+0000  push    #0  int32      33            ; 1:1  push int32(33)
+0001  push    #1  bigdecimal 0.5           ; 2:3  push bigdecimal(0.5)
+0002  add                                  ; 4:1  add
+0003  exit                                 ; 5:1  exit
+`, out.String())
+
+	out.Reset()
+	prog.Filename = "f.avm"
+	require.NoError(t, prog.Disassemble(&out, nil))
+	require.Contains(t, out.String(), "; f.avm\n; 4 instructions, 2 constants\n")
+	require.Contains(t, out.String(), "0002  add                                  ; f.avm:4:1\n")
+}
+
+func TestCompileJumps(t *testing.T) {
+	src := "push int8(3)\nloop:\npush int8(1)\nswap\nsub\ndup\njnz loop\njmp end\nend:"
+	prog := compile(t, src)
+	require.Equal(t, []Label{{Name: "loop", PC: 1}, {Name: "end", PC: 7}}, prog.Labels)
+	require.Equal(t, Instruction{Op: OpJnz, Operand: 0, Pos: token.Position{Line: 7, Column: 1}}, prog.Code[5])
+	require.Equal(t, Instruction{Op: OpJmp, Operand: 1, Pos: token.Position{Line: 8, Column: 1}}, prog.Code[6])
+
+	var buf bytes.Buffer
+	require.NoError(t, prog.Encode(&buf))
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, prog.Labels, decoded.Labels)
+
+	pg, err := parser.NewParser(src).ParseProgram()
+	require.NoError(t, err)
+	require.Equal(t, pg.String(), statements(t, decoded))
+
+	vm, err := run(decoded)
+	require.NoError(t, err)
+	require.Equal(t, []evaluator.Value{evaluator.NewInt8Value(0)}, vm.Stack.Values())
+
+	var out bytes.Buffer
+	require.NoError(t, prog.Disassemble(&out, nil))
+	require.Contains(t, out.String(), "\nloop:\n0001  push ")
+	require.Contains(t, out.String(), "0005  jnz     loop (0001)")
+	require.True(t, strings.HasSuffix(out.String(), "\nend:\n"))
+
+	prog = compile(t, "push int8(2)\ncall twice\nexit\ntwice: dup\nadd\nret")
+	require.Equal(t, Instruction{Op: OpCall, Operand: 0, Pos: token.Position{Line: 2, Column: 1}}, prog.Code[1])
+	require.Equal(t, OpRet, prog.Code[5].Op)
+
+	buf.Reset()
+	require.NoError(t, prog.Encode(&buf))
+	decoded, err = Decode(&buf)
+	require.NoError(t, err)
+
+	vm, err = run(decoded)
+	require.Equal(t, evaluator.ErrExit, err)
+	require.Equal(t, []evaluator.Value{evaluator.NewInt8Value(4)}, vm.Stack.Values())
+
+	prog = compile(t, "push int8(2)\nstore x\nload y\nload x\nstore y")
+	require.Equal(t, []string{"x", "y"}, prog.Variables)
+	require.Equal(t, []Instruction{
+		{Op: OpPush, Operand: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Op: OpStore, Operand: 0, Pos: token.Position{Line: 2, Column: 1}},
+		{Op: OpLoad, Operand: 1, Pos: token.Position{Line: 3, Column: 1}},
+		{Op: OpLoad, Operand: 0, Pos: token.Position{Line: 4, Column: 1}},
+		{Op: OpStore, Operand: 1, Pos: token.Position{Line: 5, Column: 1}},
+	}, prog.Code)
+
+	buf.Reset()
+	require.NoError(t, prog.Encode(&buf))
+	decoded, err = Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, prog.Variables, decoded.Variables)
+	require.Equal(t, "push int8(2)store xload yload xstore y", statements(t, decoded))
+
+	out.Reset()
+	require.NoError(t, prog.Disassemble(&out, nil))
+	require.Contains(t, out.String(), "0002  load    y ")
+
+	pg, err = parser.NewParser("jmp nowhere").ParseProgram()
+	require.NoError(t, err)
+	_, err = Compile(pg)
+	require.True(t, errors.Is(err, evaluator.ErrUndefinedLabel))
+}
+
+func TestCompileBitwise(t *testing.T) {
+	src := "push int8(2)\npush int8(12)\npush int8(10)\nand\nshl\nnot\npush int8(1)\nxor\npush int8(3)\nor\npush int8(1)\nswap\nsar\npush int8(1)\nswap\nshr"
+	prog := compile(t, src)
+	var ops []Opcode
+	for _, ins := range prog.Code {
+		ops = append(ops, ins.Op)
+	}
+	require.Equal(t, []Opcode{OpPush, OpPush, OpPush, OpAnd, OpShl, OpNot, OpPush, OpXor, OpPush, OpOr, OpPush, OpSwap, OpSar, OpPush, OpSwap, OpShr}, ops)
+
+	var buf bytes.Buffer
+	require.NoError(t, prog.Encode(&buf))
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+
+	pg, err := parser.NewParser(src).ParseProgram()
+	require.NoError(t, err)
+	require.Equal(t, pg.String(), statements(t, decoded))
+
+	want := evaluator.NewStack()
+	_, err = evaluator.NewVM(want).Eval(pg)
+	require.NoError(t, err)
+
+	vm, err := run(decoded)
+	require.NoError(t, err)
+	require.Equal(t, []evaluator.Value{evaluator.NewInt8Value(119)}, want.Values())
+	require.Equal(t, want.Values(), vm.Stack.Values())
+}
+
+func TestCompileStackWords(t *testing.T) {
+	src := "push int8(1)\npush int16(2)\npush int32(3)\nover\nrot\npick 3\nroll 2\ndrop 1\ndepth"
+	prog := compile(t, src)
+	require.Equal(t, Instruction{Op: OpPick, Operand: 3, Pos: token.Position{Line: 6, Column: 1}}, prog.Code[5])
+
+	var buf bytes.Buffer
+	require.NoError(t, prog.Encode(&buf))
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, prog.Code, decoded.Code)
+
+	pg, err := parser.NewParser(src).ParseProgram()
+	require.NoError(t, err)
+	require.Equal(t, pg.String(), statements(t, decoded))
+
+	want := evaluator.NewStack()
+	_, err = evaluator.NewVM(want).Eval(pg)
+	require.NoError(t, err)
+
+	vm, err := run(decoded)
+	require.NoError(t, err)
+	require.Equal(t, want.Values(), vm.Stack.Values())
+	require.Equal(t, evaluator.NewInt32Value(4), vm.Stack.Values()[0])
+
+	var out bytes.Buffer
+	require.NoError(t, prog.Disassemble(&out, nil))
+	require.Contains(t, out.String(), "0005  pick    3 ")
+}
+
+func TestCompileCast(t *testing.T) {
+	src := "push double(-2.5)\ncast int16\ncast bigdecimal"
+	prog := compile(t, src)
+	require.Equal(t, []Instruction{
+		{Op: OpPush, Operand: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Op: OpCast, Operand: int(evaluator.ShortValue), Pos: token.Position{Line: 2, Column: 1}},
+		{Op: OpCast, Operand: int(evaluator.BigDecimalValue), Pos: token.Position{Line: 3, Column: 1}},
+	}, prog.Code)
+
+	var buf bytes.Buffer
+	require.NoError(t, prog.Encode(&buf))
+	data := append([]byte(nil), buf.Bytes()...)
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "push double(-2.5)cast int16cast bigdecimal", statements(t, decoded))
+
+	vm, err := run(decoded)
+	require.NoError(t, err)
+	require.Equal(t, "[{-2 bigdecimal}]", fmt.Sprint(vm.Stack.Values()))
+
+	var out bytes.Buffer
+	require.NoError(t, prog.Disassemble(&out, nil))
+	require.Contains(t, out.String(), "0001  cast    int16 ")
+
+	i := bytes.Index(data, []byte{byte(OpCast), byte(evaluator.ShortValue)})
+	data[i+1] = 0x11
+	_, err = Decode(bytes.NewReader(rehash(data)))
+	require.EqualError(t, err, "error: unknown type 17")
+}
@@ -0,0 +1,83 @@
+package bytecode
+
+import (
+	"avm/evaluator"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Disassemble writes the instructions of the program to w, one per line
+// with its offset, opcode, and for push and assert the index, type and value
+// of its constant, for jumps and calls the label and offset they go to, for
+// store and load the name of their variable, for cast its type and for pick,
+// roll and drop their count. Labels are written on their own line before the
+// instruction they name. Each line is annotated with the position of the
+// instruction, followed by its source line when src, the source the program
+// was compiled from, is not nil.
+//
+//	0000  push    #0  int32      33            ; f.avm:4:1  push int32(33)
+func (p *Program) Disassemble(w io.Writer, src []byte) error {
+	lines := SourceLines(src)
+	bw := bufio.NewWriter(w)
+	if p.Filename != "" {
+		fmt.Fprintf(bw, "; %s\n", p.Filename)
+	}
+
+	fmt.Fprintf(bw, "; %d instructions, %d constants\n", len(p.Code), len(p.Constants))
+	labels := p.labelsAt()
+	for pc, ins := range p.Code {
+		for _, l := range labels[pc] {
+			fmt.Fprintf(bw, "%s:\n", l.Name)
+		}
+
+		var operand string
+		switch {
+		case ins.Op.HasLabel():
+			l := p.Labels[ins.Operand]
+			operand = fmt.Sprintf("%s (%04d)", l.Name, l.PC)
+		case ins.Op.HasVariable():
+			operand = p.Variables[ins.Operand]
+		case ins.Op.HasCount():
+			operand = strconv.Itoa(ins.Operand)
+		case ins.Op.HasType():
+			operand = evaluator.ValueType(ins.Operand).String()
+		case ins.Op.HasOperand():
+			v := p.Constants[ins.Operand]
+			operand = fmt.Sprintf("#%-2d %-10s %s", ins.Operand, v.Type, v.Literal())
+		}
+
+		pos := ins.Pos
+		pos.Filename = p.Filename
+		comment := pos.String()
+		if pos.Line > 0 && pos.Line <= len(lines) {
+			comment += "  " + lines[pos.Line-1]
+		}
+
+		fmt.Fprintf(bw, "%04d  %-7s %-28s ; %s\n", pc, ins.Op, operand, comment)
+	}
+
+	for _, l := range labels[len(p.Code)] {
+		fmt.Fprintf(bw, "%s:\n", l.Name)
+	}
+
+	return bw.Flush()
+}
+
+// SourceLines splits src in lines without their surrounding white spaces, as
+// they are displayed next to the instructions. It returns nil when src is nil.
+func SourceLines(src []byte) []string {
+	if src == nil {
+		return nil
+	}
+
+	lines := strings.Split(string(bytes.TrimRight(src, "\n")), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return lines
+}
@@ -0,0 +1,350 @@
+package bytecode
+
+import (
+	"avm/evaluator"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+)
+
+// Magic is the header of a compiled file.
+const Magic = "AVMC"
+
+// Version is the version of the binary format written by Encode.
+const Version = 3
+
+var (
+	// ErrBadMagic is returned when decoding a file which is not a compiled
+	// program.
+	ErrBadMagic = errors.New("error: not a compiled avm file")
+
+	// ErrChecksum is returned when the content of a compiled file does not
+	// match its checksum.
+	ErrChecksum = errors.New("error: compiled file is corrupted: checksum mismatch")
+)
+
+// A compiled file is made of:
+//
+//	magic     "AVMC"
+//	version   uint16
+//	filename  uvarint length, bytes
+//	constants uvarint count, then for each one its type byte and its value
+//	labels    uvarint count, then for each one its uvarint length, name
+//	          and uvarint instruction index
+//	variables uvarint count, then for each one its uvarint length and name
+//	code      uvarint count, then for each instruction its opcode byte, the
+//	          uvarint index of its constant for push and assert, of its
+//	          label for jumps and calls or of its variable for store and
+//	          load, the type for cast or the count of pick, roll and drop,
+//	          its uvarint line and column
+//	checksum  uint32, CRC-32 (IEEE) of everything before it
+//
+// Fixed size numbers are big endian. Integer constants are stored on the
+// size of their type, floating point ones as their IEEE 754 bits and
+// bigdecimal ones as a uvarint length followed by the "a/b" fraction.
+
+// Encode writes the binary form of the program to w.
+func (p *Program) Encode(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(Version))
+
+	putString(&buf, p.Filename)
+	putUvarint(&buf, uint64(len(p.Constants)))
+	for _, v := range p.Constants {
+		if err := putValue(&buf, v); err != nil {
+			return err
+		}
+	}
+
+	putUvarint(&buf, uint64(len(p.Labels)))
+	for _, l := range p.Labels {
+		putString(&buf, l.Name)
+		putUvarint(&buf, uint64(l.PC))
+	}
+
+	putUvarint(&buf, uint64(len(p.Variables)))
+	for _, name := range p.Variables {
+		putString(&buf, name)
+	}
+
+	putUvarint(&buf, uint64(len(p.Code)))
+	for _, ins := range p.Code {
+		buf.WriteByte(byte(ins.Op))
+		if ins.Op.HasOperand() {
+			putUvarint(&buf, uint64(ins.Operand))
+		}
+
+		putUvarint(&buf, uint64(ins.Pos.Line))
+		putUvarint(&buf, uint64(ins.Pos.Column))
+	}
+
+	_ = binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Decode reads a program written by Encode.
+func Decode(r io.Reader) (*Program, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(Magic) || string(data[:len(Magic)]) != Magic {
+		return nil, ErrBadMagic
+	}
+
+	if len(data) < len(Magic)+2+4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrChecksum
+	}
+
+	version := binary.BigEndian.Uint16(body[len(Magic):])
+	if version != Version {
+		return nil, fmt.Errorf("error: unsupported compiled file version %d, expected %d", version, Version)
+	}
+
+	d := &decoder{r: bytes.NewReader(body[len(Magic)+2:])}
+	p := &Program{Filename: d.string()}
+
+	p.Constants = make([]evaluator.Value, d.count())
+	for i := range p.Constants {
+		p.Constants[i] = d.value()
+	}
+
+	p.Labels = make([]Label, d.count())
+	for i := range p.Labels {
+		p.Labels[i].Name = d.string()
+		p.Labels[i].PC = int(d.uvarint())
+	}
+
+	p.Variables = make([]string, d.count())
+	for i := range p.Variables {
+		p.Variables[i] = d.string()
+	}
+
+	p.Code = make([]Instruction, d.count())
+	for i := range p.Code {
+		ins := &p.Code[i]
+		ins.Op = Opcode(d.byte())
+		if !ins.Op.Valid() && d.err == nil {
+			d.err = fmt.Errorf("error: unknown opcode %d", ins.Op)
+		}
+
+		if ins.Op.HasType() {
+			ins.Operand = int(d.uvarint())
+			if (ins.Operand > math.MaxUint8 || evaluator.ValueType(ins.Operand).String() == "") && d.err == nil {
+				d.err = fmt.Errorf("error: unknown type %d", ins.Operand)
+			}
+		} else if ins.Op.HasCount() {
+			ins.Operand = int(d.uvarint())
+			if ins.Operand > math.MaxInt32 && d.err == nil {
+				d.err = fmt.Errorf("error: count %d out of range", ins.Operand)
+			}
+		} else if ins.Op.HasOperand() {
+			ins.Operand = int(d.uvarint())
+			var n int
+			var kind string
+			switch {
+			case ins.Op.HasLabel():
+				n, kind = len(p.Labels), "label"
+			case ins.Op.HasVariable():
+				n, kind = len(p.Variables), "variable"
+			default:
+				n, kind = len(p.Constants), "constant"
+			}
+
+			if ins.Operand >= n && d.err == nil {
+				d.err = fmt.Errorf("error: %s %d out of range", kind, ins.Operand)
+			}
+		}
+
+		ins.Pos.Line = int(d.uvarint())
+		ins.Pos.Column = int(d.uvarint())
+	}
+
+	for _, l := range p.Labels {
+		if l.PC > len(p.Code) && d.err == nil {
+			d.err = fmt.Errorf("error: label %q out of range", l.Name)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return p, nil
+}
+
+// WriteFile compiles the program to a file.
+func (p *Program) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err := p.Encode(w); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ReadFile reads a compiled program from a file.
+func ReadFile(filename string) (*Program, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+func putUvarint(buf *bytes.Buffer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	buf.Write(b[:n])
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func putValue(buf *bytes.Buffer, v evaluator.Value) error {
+	buf.WriteByte(byte(v.Type))
+	switch v.Type {
+	case evaluator.CharValue:
+		return binary.Write(buf, binary.BigEndian, int8(v.Int()))
+	case evaluator.ShortValue:
+		return binary.Write(buf, binary.BigEndian, int16(v.Int()))
+	case evaluator.IntegerValue:
+		return binary.Write(buf, binary.BigEndian, int32(v.Int()))
+	case evaluator.FloatValue:
+		return binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case evaluator.DoubleValue:
+		return binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+	case evaluator.BigDecimalValue:
+		putString(buf, v.Decimal().RatString())
+		return nil
+	}
+
+	return fmt.Errorf("error: cannot encode constant %s", v)
+}
+
+// decoder reads the body of a compiled file. The first error is kept and
+// every read after it returns a zero value.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) read(data interface{}) {
+	if d.err != nil {
+		return
+	}
+
+	if err := binary.Read(d.r, binary.BigEndian, data); err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+}
+
+func (d *decoder) byte() byte {
+	var b byte
+	d.read(&b)
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	x, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return x
+}
+
+// count reads the number of elements of a section. It cannot exceed the
+// number of remaining bytes, which protects against huge allocations.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(d.r.Len()) {
+		if d.err == nil {
+			d.err = io.ErrUnexpectedEOF
+		}
+
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	b := make([]byte, d.count())
+	d.read(b)
+	return string(b)
+}
+
+func (d *decoder) value() evaluator.Value {
+	switch t := evaluator.ValueType(d.byte()); t {
+	case evaluator.CharValue:
+		var x int8
+		d.read(&x)
+		return evaluator.NewInt8Value(x)
+	case evaluator.ShortValue:
+		var x int16
+		d.read(&x)
+		return evaluator.NewInt16Value(x)
+	case evaluator.IntegerValue:
+		var x int32
+		d.read(&x)
+		return evaluator.NewInt32Value(x)
+	case evaluator.FloatValue:
+		var x uint32
+		d.read(&x)
+		return evaluator.NewFloatValue(math.Float32frombits(x))
+	case evaluator.DoubleValue:
+		var x uint64
+		d.read(&x)
+		return evaluator.NewDoubleValue(math.Float64frombits(x))
+	case evaluator.BigDecimalValue:
+		s := d.string()
+		x, ok := new(big.Rat).SetString(s)
+		if !ok && d.err == nil {
+			d.err = fmt.Errorf("error: bad bigdecimal constant %q", s)
+		}
+
+		return evaluator.NewBigDecimalValue(x)
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("error: unknown constant type %d", byte(t))
+		}
+	}
+
+	return evaluator.Value{}
+}
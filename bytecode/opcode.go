@@ -0,0 +1,115 @@
+package bytecode
+
+import (
+	"avm/evaluator"
+	"avm/token"
+)
+
+// Opcode identifies an instruction in a compiled program, see
+// evaluator.Opcode.
+type Opcode = evaluator.Opcode
+
+const (
+	OpPush   = evaluator.OpPush
+	OpPop    = evaluator.OpPop
+	OpDump   = evaluator.OpDump
+	OpClear  = evaluator.OpClear
+	OpDup    = evaluator.OpDup
+	OpSwap   = evaluator.OpSwap
+	OpAssert = evaluator.OpAssert
+	OpAdd    = evaluator.OpAdd
+	OpSub    = evaluator.OpSub
+	OpMul    = evaluator.OpMul
+	OpDiv    = evaluator.OpDiv
+	OpMod    = evaluator.OpMod
+	OpPrint  = evaluator.OpPrint
+	OpExit   = evaluator.OpExit
+	OpJmp    = evaluator.OpJmp
+	OpJz     = evaluator.OpJz
+	OpJnz    = evaluator.OpJnz
+	OpJlt    = evaluator.OpJlt
+	OpJgt    = evaluator.OpJgt
+	OpEq     = evaluator.OpEq
+	OpNeq    = evaluator.OpNeq
+	OpLt     = evaluator.OpLt
+	OpLe     = evaluator.OpLe
+	OpGt     = evaluator.OpGt
+	OpGe     = evaluator.OpGe
+	OpCall   = evaluator.OpCall
+	OpRet    = evaluator.OpRet
+	OpStore  = evaluator.OpStore
+	OpLoad   = evaluator.OpLoad
+	OpAnd    = evaluator.OpAnd
+	OpOr     = evaluator.OpOr
+	OpXor    = evaluator.OpXor
+	OpNot    = evaluator.OpNot
+	OpShl    = evaluator.OpShl
+	OpShr    = evaluator.OpShr
+	OpSar    = evaluator.OpSar
+	OpNeg    = evaluator.OpNeg
+	OpAbs    = evaluator.OpAbs
+	OpMin    = evaluator.OpMin
+	OpMax    = evaluator.OpMax
+	OpPow    = evaluator.OpPow
+	OpSqrt   = evaluator.OpSqrt
+	OpExp    = evaluator.OpExp
+	OpLog    = evaluator.OpLog
+	OpSin    = evaluator.OpSin
+	OpCos    = evaluator.OpCos
+	OpCast   = evaluator.OpCast
+	OpOver   = evaluator.OpOver
+	OpRot    = evaluator.OpRot
+	OpPick   = evaluator.OpPick
+	OpRoll   = evaluator.OpRoll
+	OpDrop   = evaluator.OpDrop
+	OpDepth  = evaluator.OpDepth
+)
+
+var jumpOpcodes = map[token.TokenType]Opcode{
+	token.JMP: OpJmp,
+	token.JZ:  OpJz,
+	token.JNZ: OpJnz,
+	token.JLT: OpJlt,
+	token.JGT: OpJgt,
+}
+
+var compareOpcodes = map[token.TokenType]Opcode{
+	token.CMPEQ:  OpEq,
+	token.CMPNEQ: OpNeq,
+	token.CMPLT:  OpLt,
+	token.CMPLE:  OpLe,
+	token.CMPGT:  OpGt,
+	token.CMPGE:  OpGe,
+}
+
+var stackOpcodes = map[token.TokenType]Opcode{
+	token.OVER:  OpOver,
+	token.ROT:   OpRot,
+	token.PICK:  OpPick,
+	token.ROLL:  OpRoll,
+	token.DROP:  OpDrop,
+	token.DEPTH: OpDepth,
+}
+
+var mathOpcodes = map[token.TokenType]Opcode{
+	token.NEG:  OpNeg,
+	token.ABS:  OpAbs,
+	token.MIN:  OpMin,
+	token.MAX:  OpMax,
+	token.POW:  OpPow,
+	token.SQRT: OpSqrt,
+	token.EXP:  OpExp,
+	token.LOG:  OpLog,
+	token.SIN:  OpSin,
+	token.COS:  OpCos,
+}
+
+var bitwiseOpcodes = map[token.TokenType]Opcode{
+	token.AND: OpAnd,
+	token.OR:  OpOr,
+	token.XOR: OpXor,
+	token.NOT: OpNot,
+	token.SHL: OpShl,
+	token.SHR: OpShr,
+	token.SAR: OpSar,
+}
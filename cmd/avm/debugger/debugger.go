@@ -0,0 +1,362 @@
+// Package debugger runs a program one instruction at a time, stopping on
+// breakpoints to inspect the stack.
+package debugger
+
+import (
+	"avm/ast"
+	"avm/bytecode"
+	"avm/evaluator"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PROMPT = "(avm) "
+
+// DefaultMaxSteps is the number of instructions next and continue execute
+// before pausing, unless the Debugger is configured otherwise.
+const DefaultMaxSteps = 1000000
+
+// Debugger drives the execution of a program loaded in a VM from commands
+// read on its input.
+type Debugger struct {
+	vm          *evaluator.VM
+	lines       []string     // lines of the source, if any
+	stmtLines   map[int]bool // lines holding an instruction
+	breakpoints map[int]bool
+	out         io.Writer
+	done        bool // the program ended, exited or failed
+	executed    int  // number of instructions executed
+
+	// MaxSteps is the number of instructions next and continue execute
+	// before pausing, so that an endless loop does not hang the debugger.
+	// 0 means unlimited.
+	MaxSteps int
+}
+
+type command struct {
+	name string
+	opts string
+	help string
+	run  func(d *Debugger, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "break", opts: "[line]", help: "Stop before the instructions of the line, or list the breakpoints.", run: (*Debugger).breakCmd},
+		{name: "step", help: "Execute the next instruction.", run: (*Debugger).stepCmd},
+		{name: "next", help: "Execute the next instruction, running a call until it returns.", run: (*Debugger).nextCmd},
+		{name: "continue", help: "Execute the instructions until a breakpoint or the end of the program.", run: (*Debugger).continueCmd},
+		{name: "stack", help: "Display each value of the stack, from the top to the bottom.", run: (*Debugger).stackCmd},
+		{name: "peek", opts: "n", help: "Display the value at the index n, 0 being the top of the stack.", run: (*Debugger).peekCmd},
+		{name: "where", help: "Display the next instruction and the calls which have not returned.", run: (*Debugger).whereCmd},
+		{name: "help", help: "Display this help.", run: (*Debugger).helpCmd},
+	}
+}
+
+// New returns a debugger stopped before the first instruction of pg, which is
+// loaded in vm. src is the source of the program, used to display the
+// current line, it can be nil.
+func New(vm *evaluator.VM, pg *ast.Program, src []byte) (*Debugger, error) {
+	if err := vm.Load(pg); err != nil {
+		return nil, err
+	}
+
+	d := &Debugger{
+		vm:          vm,
+		lines:       bytecode.SourceLines(src),
+		stmtLines:   make(map[int]bool),
+		breakpoints: make(map[int]bool),
+		done:        vm.Done(),
+		MaxSteps:    DefaultMaxSteps,
+	}
+	for _, stmt := range pg.Statements {
+		if _, ok := stmt.(*ast.LabelStatement); !ok {
+			d.stmtLines[stmt.Pos().Line] = true
+		}
+	}
+
+	return d, nil
+}
+
+// Run reads commands from in until quit or the end of the input, and writes
+// their output to out.
+func (d *Debugger) Run(in io.Reader, out io.Writer) error {
+	d.Start(out)
+	s := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, PROMPT)
+		if !s.Scan() {
+			fmt.Fprintln(out)
+			return s.Err()
+		}
+
+		if !d.Execute(s.Text()) {
+			return nil
+		}
+	}
+}
+
+// Start displays the first instruction and the stack on out, which receives
+// the output of the commands given to Execute.
+func (d *Debugger) Start(out io.Writer) {
+	d.out = out
+	d.stop()
+}
+
+// Execute runs a command line, e.g. "break 6", and reports whether the
+// debugger expects more commands, which is not the case after quit.
+func (d *Debugger) Execute(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	if fields[0] == "quit" {
+		return false
+	}
+
+	if err := d.dispatch(fields[0], fields[1:]); err != nil {
+		fmt.Fprintln(d.out, err)
+	}
+
+	return true
+}
+
+// dispatch runs the command whose name starts with name.
+func (d *Debugger) dispatch(name string, args []string) error {
+	for _, c := range commands {
+		if strings.HasPrefix(c.name, name) {
+			return c.run(d, args)
+		}
+	}
+
+	return fmt.Errorf("error: unknown command %q, enter \"help\" for the list of commands", name)
+}
+
+func (d *Debugger) breakCmd(args []string) error {
+	if len(args) == 0 {
+		lines := make([]int, 0, len(d.breakpoints))
+		for l := range d.breakpoints {
+			lines = append(lines, l)
+		}
+		sort.Ints(lines)
+		for _, l := range lines {
+			fmt.Fprintf(d.out, "breakpoint at line %d  %s\n", l, d.line(l))
+		}
+		return nil
+	}
+
+	l, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("error: bad line %q", args[0])
+	}
+
+	if !d.stmtLines[l] {
+		return fmt.Errorf("error: no instruction on line %d", l)
+	}
+
+	d.breakpoints[l] = true
+	fmt.Fprintf(d.out, "breakpoint at line %d\n", l)
+	return nil
+}
+
+func (d *Debugger) stepCmd(args []string) error {
+	if err := d.running(); err != nil {
+		return err
+	}
+
+	d.step()
+	d.stop()
+	return nil
+}
+
+func (d *Debugger) nextCmd(args []string) error {
+	if err := d.running(); err != nil {
+		return err
+	}
+
+	depth := len(d.vm.Calls())
+	d.runUntil(func() bool {
+		return len(d.vm.Calls()) <= depth || d.atBreakpoint()
+	})
+	d.stop()
+	return nil
+}
+
+func (d *Debugger) continueCmd(args []string) error {
+	if err := d.running(); err != nil {
+		return err
+	}
+
+	d.runUntil(d.atBreakpoint)
+	d.stop()
+	return nil
+}
+
+func (d *Debugger) stackCmd(args []string) error {
+	if d.vm.Stack.IsEmpty() {
+		fmt.Fprintln(d.out, "stack: empty")
+		return nil
+	}
+
+	fmt.Fprintln(d.out, "stack:")
+	for i, v := range d.vm.Stack.Values() {
+		fmt.Fprintf(d.out, "  %d  %s(%s)\n", i, v.Type, v.Literal())
+	}
+
+	return nil
+}
+
+func (d *Debugger) peekCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: peek n")
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("error: bad index %q", args[0])
+	}
+
+	v, err := d.vm.Stack.Peek(n)
+	if err != nil {
+		return fmt.Errorf("error: %s: got %d values on the stack", err, d.vm.Stack.Size())
+	}
+
+	fmt.Fprintf(d.out, "%d  %s(%s)\n", n, v.Type, v.Literal())
+	return nil
+}
+
+func (d *Debugger) whereCmd(args []string) error {
+	if d.done {
+		fmt.Fprintln(d.out, "the program is not running")
+		return nil
+	}
+
+	fmt.Fprintln(d.out, d.current())
+	for _, pos := range d.vm.Calls() {
+		fmt.Fprintf(d.out, "  called from %s  %s\n", pos, d.line(pos.Line))
+	}
+
+	return nil
+}
+
+func (d *Debugger) helpCmd(args []string) error {
+	for _, c := range commands {
+		fmt.Fprintf(d.out, "%-8s %-7s %s\n", c.name, c.opts, c.help)
+	}
+	fmt.Fprintf(d.out, "%-8s %-7s %s\n", "quit", "", "Leave the debugger.")
+	return nil
+}
+
+// running returns an error when the program cannot execute any instruction.
+func (d *Debugger) running() error {
+	if d.done {
+		return errors.New("error: the program is not running")
+	}
+
+	return nil
+}
+
+// runUntil executes instructions until stop returns true, after the first
+// one, or until the program ends. It pauses after MaxSteps instructions, and
+// halts the program when the command runs for longer than the timeout of the
+// VM.
+func (d *Debugger) runUntil(stop func() bool) {
+	var deadline time.Time
+	if d.vm.Timeout > 0 {
+		deadline = time.Now().Add(d.vm.Timeout)
+	}
+
+	for steps := 0; !d.done; steps++ {
+		if steps > 0 && stop() {
+			return
+		}
+
+		if d.MaxSteps > 0 && steps >= d.MaxSteps {
+			fmt.Fprintf(d.out, "paused after %d instructions\n", steps)
+			return
+		}
+
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			d.halt(context.DeadlineExceeded)
+			return
+		}
+
+		d.step()
+	}
+}
+
+// halt ends the program before the next instruction because of err.
+func (d *Debugger) halt(err error) {
+	d.done = true
+	fmt.Fprintln(d.out, &evaluator.HaltError{Pos: d.vm.Next().Pos(), Executed: d.executed, Err: err})
+}
+
+// step executes the next instruction, reporting how the program ended when it
+// does. The program is halted once it has executed the instructions allowed
+// by the VM.
+func (d *Debugger) step() {
+	if d.vm.MaxInstructions > 0 && d.executed >= d.vm.MaxInstructions {
+		d.halt(evaluator.ErrInstructionLimit)
+		return
+	}
+
+	d.executed++
+	_, err := d.vm.Step()
+	switch {
+	case errors.Is(err, evaluator.ErrExit):
+		d.done = true
+		fmt.Fprintln(d.out, "the program exited")
+	case err != nil:
+		d.done = true
+		fmt.Fprintln(d.out, err)
+	case d.vm.Done():
+		d.done = true
+		fmt.Fprintln(d.out, "the program finished")
+	}
+}
+
+// atBreakpoint reports whether the next instruction is on a breakpoint line.
+func (d *Debugger) atBreakpoint() bool {
+	stmt := d.vm.Next()
+	return stmt != nil && d.breakpoints[stmt.Pos().Line]
+}
+
+// stop displays the next instruction and the stack.
+func (d *Debugger) stop() {
+	if !d.done {
+		fmt.Fprintln(d.out, d.current())
+	}
+
+	_ = d.stackCmd(nil)
+}
+
+// current returns the position of the next instruction followed by its
+// source line, or by the instruction itself without source.
+func (d *Debugger) current() string {
+	stmt := d.vm.Next()
+	line := d.line(stmt.Pos().Line)
+	if line == "" {
+		line = stmt.String()
+	}
+
+	return fmt.Sprintf("%s  %s", stmt.Pos(), line)
+}
+
+// line returns the source line l, or an empty string without source.
+func (d *Debugger) line(l int) string {
+	if l < 1 || l > len(d.lines) {
+		return ""
+	}
+
+	return d.lines[l-1]
+}
@@ -0,0 +1,142 @@
+package debugger
+
+import (
+	"avm/evaluator"
+	"avm/parser"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const input = `push int32(2)
+call square
+push int8(1)
+add
+exit
+
+square:
+	dup
+	mul
+	ret
+`
+
+// debug runs the commands on the program and returns the output of the
+// debugger.
+func debug(t *testing.T, commands ...string) string {
+	pg, err := parser.NewParser(input).ParseProgram()
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.Stdout = &out
+	d, err := New(vm, pg, []byte(input))
+	require.NoError(t, err)
+
+	require.NoError(t, d.Run(strings.NewReader(strings.Join(commands, "\n")), &out))
+	return out.String()
+}
+
+func TestBreakContinue(t *testing.T) {
+	out := debug(t, "break 9", "break", "continue", "where", "peek 1", "quit")
+	require.Equal(t, `1:1  push int32(2)
+stack: empty
+(avm) breakpoint at line 9
+(avm) breakpoint at line 9  mul
+(avm) 9:2  mul
+stack:
+  0  int32(2)
+  1  int32(2)
+(avm) 9:2  mul
+  called from 2:1  call square
+(avm) 1  int32(2)
+(avm) `, out)
+}
+
+func TestStepNext(t *testing.T) {
+	out := debug(t, "step", "next", "s", "stack", "continue", "step")
+	require.Equal(t, `1:1  push int32(2)
+stack: empty
+(avm) 2:1  call square
+stack:
+  0  int32(2)
+(avm) 3:1  push int8(1)
+stack:
+  0  int32(4)
+(avm) 4:1  add
+stack:
+  0  int8(1)
+  1  int32(4)
+(avm) stack:
+  0  int8(1)
+  1  int32(4)
+(avm) the program exited
+stack:
+  0  int32(5)
+(avm) error: the program is not running
+(avm) 
+`, out)
+}
+
+func TestCommandErrors(t *testing.T) {
+	out := debug(t, "break 6", "break x", "peek", "peek 3", "frobnicate", "quit")
+	require.Contains(t, out, "error: no instruction on line 6\n")
+	require.Contains(t, out, "error: bad line \"x\"\n")
+	require.Contains(t, out, "usage: peek n\n")
+	require.Contains(t, out, "error: index 3 out of range: got 0 values on the stack\n")
+	require.Contains(t, out, "error: unknown command \"frobnicate\"")
+}
+
+func TestExecute(t *testing.T) {
+	pg, err := parser.NewParser(input).ParseProgram()
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	vm := evaluator.NewVM(evaluator.NewStack())
+	d, err := New(vm, pg, nil)
+	require.NoError(t, err)
+
+	d.Start(&out)
+	require.True(t, d.Execute(""))
+	require.True(t, d.Execute("step"))
+	require.False(t, d.Execute("quit"))
+	require.Equal(t, `1:1  push int32(2)
+stack: empty
+2:1  call square
+stack:
+  0  int32(2)
+`, out.String())
+}
+
+func TestEndlessLoop(t *testing.T) {
+	// the call never returns
+	const loop = "push int8(1)\ncall loop\nloop: jmp loop"
+	run := func(vm *evaluator.VM, maxSteps int, commands ...string) string {
+		pg, err := parser.NewParser(loop).ParseProgram()
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		d, err := New(vm, pg, nil)
+		require.NoError(t, err)
+		d.MaxSteps = maxSteps
+		require.NoError(t, d.Run(strings.NewReader(strings.Join(commands, "\n")), &out))
+		return out.String()
+	}
+
+	out := run(evaluator.NewVM(evaluator.NewStack()), 10, "step", "next", "continue", "quit")
+	require.Equal(t, 2, strings.Count(out, "paused after 10 instructions\n"))
+	require.Contains(t, out, "(avm) paused after 10 instructions\n3:7  jmp loop\n")
+
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.MaxInstructions = 5
+	out = run(vm, 0, "continue", "step", "quit")
+	require.Contains(t, out, "(avm) 3:7: halted after 5 instructions: error: instruction limit exceeded\n")
+	require.Contains(t, out, "(avm) error: the program is not running\n")
+
+	vm = evaluator.NewVM(evaluator.NewStack())
+	vm.Timeout = time.Millisecond
+	out = run(vm, 0, "continue", "quit")
+	require.Contains(t, out, "context deadline exceeded\n")
+}
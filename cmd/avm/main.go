@@ -1,53 +1,287 @@
 package main
 
 import (
-	"avm/reader"
+	"avm/ast"
+	"avm/bytecode"
+	"avm/cmd/avm/debugger"
 	"avm/cmd/avm/shell"
+	"avm/evaluator"
+	"avm/parser"
+	"avm/reader"
+	"bufio"
+	"context"
 	"fmt"
 	"github.com/urfave/cli/v2"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-func run(args []string, r io.Reader, w io.Writer) error {
-	// check usage are respected
-	if len(args) > 2 {
-		return fmt.Errorf("too few arguments, got %d expected %d\nusage: avm [filename.avm] ", len(args)-1, 1)
-	}
-	
-	// no Args start CLI mod
-	if len(args) == 1 {
-		app := cli.App{
-			Name:                 "Abstact VM",
-			Usage:                "Enter an instruction",
-			EnableBashCompletion: true,
-			Action: func(ctx *cli.Context) error {
-				return shell.Run(os.Stdin, os.Stdout)
+func run(args []string, r io.Reader, w, errw io.Writer) error {
+	app := cli.App{
+		Name:                 "avm",
+		Usage:                "Abstract VM interpreter",
+		ArgsUsage:            "[filename.avm]",
+		EnableBashCompletion: true,
+		Writer:               w,
+		ErrWriter:            errw,
+		// no Args start CLI mod
+		Action: func(ctx *cli.Context) error {
+			switch ctx.NArg() {
+			case 0:
+				return shell.Run(r, w)
+			case 1:
+				return runFile(ctx.Args().First(), w)
+			}
+
+			return fmt.Errorf("too many arguments, got %d expected %d\nusage: avm [filename.avm]", ctx.NArg(), 1)
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "run",
+				Usage:     "Run a source or compiled program",
+				ArgsUsage: "filename.avm|filename.avmc",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "trace",
+						Usage: "write a JSON line describing each executed instruction to `FILE`",
+					},
+					&cli.StringFlag{
+						Name:  "profile",
+						Usage: "write a pprof profile of the instructions to `FILE` and display a summary",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return fmt.Errorf("usage: avm run [--trace trace.jsonl] [--profile out.pprof] filename.avm|filename.avmc")
+					}
+
+					return instrumentFile(ctx.Args().First(), ctx.String("trace"), ctx.String("profile"), w, errw)
+				},
 			},
+			{
+				Name:      "compile",
+				Usage:     "Compile a program to bytecode",
+				ArgsUsage: "filename.avm",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "write the compiled program to `FILE` instead of filename.avmc",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return fmt.Errorf("usage: avm compile [-o output.avmc] filename.avm")
+					}
+
+					return compileFile(ctx.Args().First(), ctx.String("output"))
+				},
+			},
+			{
+				Name:      "disasm",
+				Usage:     "Display the instructions of a compiled program",
+				ArgsUsage: "filename.avmc",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "source",
+						Usage: "annotate the instructions with the lines of `FILE`, by default the file the program was compiled from",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return fmt.Errorf("usage: avm disasm [--source filename.avm] filename.avmc")
+					}
+
+					return disasmFile(ctx.Args().First(), ctx.String("source"), w)
+				},
+			},
+			{
+				Name:      "debug",
+				Usage:     "Run a program one instruction at a time",
+				ArgsUsage: "filename.avm|filename.avmc",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return fmt.Errorf("usage: avm debug filename.avm|filename.avmc")
+					}
+
+					return debugFile(ctx.Args().First(), r, w)
+				},
+			},
+		},
+	}
+
+	return app.Run(args)
+}
+
+// checkExtension makes sure the file has one of the given extensions.
+func checkExtension(filename string, exts ...string) error {
+	ext := filepath.Ext(filename)
+	for _, e := range exts {
+		if ext == e {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("bad file format, got %q format but expected %s format", ext, strings.Join(exts, " or "))
+}
+
+func runFile(filename string, w io.Writer) error {
+	if err := checkExtension(filename, ".avm", ".avmc"); err != nil {
+		return err
+	}
+
+	return reader.ReadFile(filename, w)
+}
+
+// instrumentFile runs filename like runFile, writing the trace of its
+// instructions to the file trace and its profile to the file profile unless
+// they are empty. The summary of the profile is written to errw.
+func instrumentFile(filename, trace, profile string, w, errw io.Writer) (err error) {
+	if trace == "" && profile == "" {
+		return runFile(filename, w)
+	}
+
+	if err := checkExtension(filename, ".avm", ".avmc"); err != nil {
+		return err
+	}
+
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.Stdout = w
+	if trace != "" {
+		f, cerr := os.Create(trace)
+		if cerr != nil {
+			return cerr
 		}
-		
-		if err := app.Run(os.Args); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
-			os.Exit(1)
+		defer closeFile(f, &err)
+
+		bw := bufio.NewWriter(f)
+		defer func() {
+			if ferr := bw.Flush(); err == nil {
+				err = ferr
+			}
+		}()
+		vm.Trace = bw
+	}
+
+	if profile != "" {
+		f, cerr := os.Create(profile)
+		if cerr != nil {
+			return cerr
 		}
+		defer closeFile(f, &err)
+
+		vm.Profile = evaluator.NewProfile()
+		defer func() {
+			// the profile of a failing program is written as well
+			if perr := vm.Profile.WritePprof(f); err == nil {
+				err = perr
+			}
+			if serr := vm.Profile.WriteSummary(errw); err == nil {
+				err = serr
+			}
+		}()
 	}
-	// parse .avm file
-	filename := os.Args[1]
-	// make sur we have a .avm file as input file
-	if !strings.HasSuffix(filename, ".avm") {
-		ext := strings.Split(filename, ".")
-		return fmt.Errorf("bad file format, got \".%s\" format but expected .avm format", ext[1])
+
+	return reader.RunFile(context.Background(), vm, filename)
+}
+
+// closeFile closes f, setting *err when it is nil and the close fails.
+func closeFile(f *os.File, err *error) {
+	if cerr := f.Close(); *err == nil {
+		*err = cerr
 	}
-	
-	return reader.ReadFile(filename)
-	
+}
+
+func compileFile(filename, output string) error {
+	if err := checkExtension(filename, ".avm"); err != nil {
+		return err
+	}
+
+	pg, err := parser.ParseFile(filename)
+	if err != nil {
+		return err
+	}
+
+	prog, err := bytecode.Compile(pg)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(filename, ".avm") + ".avmc"
+	}
+
+	return prog.WriteFile(output)
+}
+
+func disasmFile(filename, source string, w io.Writer) error {
+	if err := checkExtension(filename, ".avmc"); err != nil {
+		return err
+	}
+
+	prog, err := bytecode.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var src []byte
+	if source != "" {
+		if src, err = ioutil.ReadFile(source); err != nil {
+			return err
+		}
+	} else {
+		// the source is only an annotation, ignore it when it has moved
+		src, _ = ioutil.ReadFile(prog.Filename)
+	}
+
+	return prog.Disassemble(w, src)
+}
+
+func debugFile(filename string, r io.Reader, w io.Writer) error {
+	if err := checkExtension(filename, ".avm", ".avmc"); err != nil {
+		return err
+	}
+
+	var pg *ast.Program
+	var src []byte
+	if filepath.Ext(filename) == ".avmc" {
+		prog, err := bytecode.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		if pg, err = prog.AST(); err != nil {
+			return err
+		}
+		// the source is only displayed, ignore it when it has moved
+		src, _ = ioutil.ReadFile(prog.Filename)
+	} else {
+		var err error
+		if src, err = ioutil.ReadFile(filename); err != nil {
+			return err
+		}
+
+		if pg, err = parser.ParseFile(filename); err != nil {
+			return err
+		}
+	}
+
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.Stdout = w
+	d, err := debugger.New(vm, pg, src)
+	if err != nil {
+		return err
+	}
+
+	return d.Run(r, w)
 }
 
 func main() {
-	if err := run(os.Args, os.Stdin, os.Stdout); err != nil {
+	if err := run(os.Args, os.Stdin, os.Stdout, os.Stderr); err != nil {
 		log.Fatal(err)
 	}
-	
 }
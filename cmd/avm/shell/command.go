@@ -2,12 +2,14 @@ package shell
 
 import (
 	"fmt"
+	"io"
 )
 
 type Command struct {
 	name string
 	opts string
 	help string
+	run  func(sh *Shell) error // set for the commands of the shell, nil for instructions
 }
 
 type Instructions struct {
@@ -25,14 +27,60 @@ func registerCommands() {
 	instructions.cmds = append(instructions.cmds, Command{name: "mod", help: "Unstack the first two values in the stack, calculate their modulo."})
 	instructions.cmds = append(instructions.cmds, Command{name: "mul", help: "Unstack the first two values in the stack, multiply them."})
 	instructions.cmds = append(instructions.cmds, Command{name: "sub", help: "Unstack the first two values in the stack, substract them."})
+	instructions.cmds = append(instructions.cmds, Command{name: "dump", help: "Display each value of the stack, from the most recent one to the oldest one."})
+	instructions.cmds = append(instructions.cmds, Command{name: "clear", help: "Remove every value from the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "dup", help: "Stack a copy of the value at the top of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "swap", help: "Swap the first two values of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "print", help: "Display the int8 value at the top of the stack as an ASCII character."})
+	instructions.cmds = append(instructions.cmds, Command{name: "exit", help: "Terminate the execution of the program."})
+	instructions.cmds = append(instructions.cmds, Command{name: "eq", help: "Unstack the first two values in the stack, stack int8(1) if they are equal, int8(0) otherwise."})
+	instructions.cmds = append(instructions.cmds, Command{name: "neq", help: "Unstack the first two values in the stack, stack int8(1) if they are different, int8(0) otherwise."})
+	instructions.cmds = append(instructions.cmds, Command{name: "lt", help: "Unstack the first two values in the stack, stack int8(1) if the first one is lower, int8(0) otherwise."})
+	instructions.cmds = append(instructions.cmds, Command{name: "le", help: "Unstack the first two values in the stack, stack int8(1) if the first one is lower or equal, int8(0) otherwise."})
+	instructions.cmds = append(instructions.cmds, Command{name: "gt", help: "Unstack the first two values in the stack, stack int8(1) if the first one is greater, int8(0) otherwise."})
+	instructions.cmds = append(instructions.cmds, Command{name: "ge", help: "Unstack the first two values in the stack, stack int8(1) if the first one is greater or equal, int8(0) otherwise."})
+	instructions.cmds = append(instructions.cmds, Command{name: "over", help: "Stack a copy of the second value of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "rot", help: "Move the third value of the stack to the top."})
+	instructions.cmds = append(instructions.cmds, Command{name: "pick", opts: "n", help: "Stack a copy of the value at the index n, 0 being the top of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "roll", opts: "n", help: "Move the value at the index n to the top of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "drop", opts: "n", help: "Remove the first n values of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "depth", help: "Stack the number of values in the stack as an int32."})
+	instructions.cmds = append(instructions.cmds, Command{name: "cast", opts: "type", help: "Convert the value at the top of the stack to the type, failing if it does not fit. Decimals are truncated towards zero."})
+	instructions.cmds = append(instructions.cmds, Command{name: "neg", help: "Replace the value at the top of the stack by its opposite."})
+	instructions.cmds = append(instructions.cmds, Command{name: "abs", help: "Replace the value at the top of the stack by its absolute value."})
+	instructions.cmds = append(instructions.cmds, Command{name: "min", help: "Unstack the first two values in the stack, stack the lower one."})
+	instructions.cmds = append(instructions.cmds, Command{name: "max", help: "Unstack the first two values in the stack, stack the greater one."})
+	instructions.cmds = append(instructions.cmds, Command{name: "pow", help: "Unstack the first two values in the stack, stack the first one raised to the second one, an integer."})
+	instructions.cmds = append(instructions.cmds, Command{name: "sqrt", help: "Replace the float or double value at the top of the stack by its square root."})
+	instructions.cmds = append(instructions.cmds, Command{name: "exp", help: "Replace the float or double value at the top of the stack by its exponential."})
+	instructions.cmds = append(instructions.cmds, Command{name: "log", help: "Replace the float or double value at the top of the stack by its natural logarithm."})
+	instructions.cmds = append(instructions.cmds, Command{name: "sin", help: "Replace the float or double value at the top of the stack by its sine, in radians."})
+	instructions.cmds = append(instructions.cmds, Command{name: "cos", help: "Replace the float or double value at the top of the stack by its cosine, in radians."})
+	instructions.cmds = append(instructions.cmds, Command{name: "and", help: "Unstack the first two integer values in the stack, stack their bitwise and."})
+	instructions.cmds = append(instructions.cmds, Command{name: "or", help: "Unstack the first two integer values in the stack, stack their bitwise or."})
+	instructions.cmds = append(instructions.cmds, Command{name: "xor", help: "Unstack the first two integer values in the stack, stack their bitwise exclusive or."})
+	instructions.cmds = append(instructions.cmds, Command{name: "not", help: "Invert the bits of the integer value at the top of the stack."})
+	instructions.cmds = append(instructions.cmds, Command{name: "shl", help: "Unstack the first two integer values in the stack, stack the first one shifted left by the second one."})
+	instructions.cmds = append(instructions.cmds, Command{name: "shr", help: "Unstack the first two integer values in the stack, stack the first one shifted right by the second one, filling with zeros."})
+	instructions.cmds = append(instructions.cmds, Command{name: "sar", help: "Unstack the first two integer values in the stack, stack the first one shifted right by the second one, keeping its sign."})
+	instructions.cmds = append(instructions.cmds, Command{name: "jmp", opts: "label", help: "Continue the execution after the label."})
+	instructions.cmds = append(instructions.cmds, Command{name: "jz", opts: "label", help: "Unstack the value at the top of the stack, jump to the label if it is zero."})
+	instructions.cmds = append(instructions.cmds, Command{name: "jnz", opts: "label", help: "Unstack the value at the top of the stack, jump to the label if it is not zero."})
+	instructions.cmds = append(instructions.cmds, Command{name: "jlt", opts: "label", help: "Unstack the value at the top of the stack, jump to the label if it is negative."})
+	instructions.cmds = append(instructions.cmds, Command{name: "jgt", opts: "label", help: "Unstack the value at the top of the stack, jump to the label if it is positive."})
+	instructions.cmds = append(instructions.cmds, Command{name: "store", opts: "name", help: "Unstack the value at the top of the stack into the variable."})
+	instructions.cmds = append(instructions.cmds, Command{name: "load", opts: "name", help: "Stack a copy of the value of the variable."})
+	instructions.cmds = append(instructions.cmds, Command{name: "call", opts: "label", help: "Call the subroutine starting at the label."})
+	instructions.cmds = append(instructions.cmds, Command{name: "ret", help: "Return from the subroutine, after the last call."})
+	instructions.cmds = append(instructions.cmds, Command{name: ".debug", help: "Debug the instructions which ran successfully so far, until quit.", run: (*Shell).debug})
 }
 
-func displayHelpCommand() error {
+func displayHelpCommand(w io.Writer) error {
 	commands := instructions.cmds
 	for _, c := range commands {
 		indent := 15 - len(c.opts) - len(c.name)
-		fmt.Printf("%s %s", c.name, c.opts)
-		fmt.Printf("%*s%s\n", indent, "", c.help)
+		fmt.Fprintf(w, "%s %s", c.name, c.opts)
+		fmt.Fprintf(w, "%*s%s\n", indent, "", c.help)
 	}
 
 	return nil
@@ -42,10 +90,22 @@ func getCommands() []Command {
 	return instructions.cmds
 }
 
+// lookupShellCommand returns the command of the shell named name, if any.
+func lookupShellCommand(name string) (Command, bool) {
+	for _, c := range instructions.cmds {
+		if c.run != nil && c.name == name {
+			return c, true
+		}
+	}
+
+	return Command{}, false
+}
+
 func getAllOperands() []string {
 	return []string{"int8",
 		"int16",
 		"int32",
 		"float",
-		"double"}
+		"double",
+		"bigdecimal"}
 }
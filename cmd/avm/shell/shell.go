@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"avm/cmd/avm/debugger"
 	"avm/evaluator"
 	"avm/parser"
 	"bufio"
@@ -21,9 +22,12 @@ const (
 )
 
 type Shell struct {
-	prompt  string
-	history []string
-	st      *evaluator.Stack
+	prompt   string
+	history  []string
+	vm       *evaluator.VM
+	out      io.Writer
+	lines    []string           // instructions entered so far which ran successfully
+	debugger *debugger.Debugger // set while debugging the instructions
 }
 
 func (sh *Shell) dumpHistory() error {
@@ -83,7 +87,7 @@ func (sh *Shell) runInstruction(in string) error {
 	p := parser.NewParser(in)
 	pg, err := p.ParseInstruction()
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Fprintln(sh.out, err.Error())
 		return err
 	}
 
@@ -91,11 +95,17 @@ func (sh *Shell) runInstruction(in string) error {
 		return errors.New("empty program")
 	}
 
-	_, err = sh.st.Eval(pg)
+	_, err = sh.vm.Eval(pg)
+	if errors.Is(err, evaluator.ErrExit) {
+		_ = sh.dumpHistory()
+		os.Exit(0)
+	}
+
 	if err != nil {
-		fmt.Println(err.Error() + in)
+		fmt.Fprintln(sh.out, err.Error())
 	} else {
-		_, _ = sh.st.Dump()
+		sh.lines = append(sh.lines, in)
+		_ = sh.vm.Stack.Dump(sh.out)
 	}
 
 	return nil
@@ -103,17 +113,54 @@ func (sh *Shell) runInstruction(in string) error {
 
 func (sh *Shell) executeInput(in string) error {
 	in = strings.TrimSpace(in)
+	if sh.debugger != nil {
+		if !sh.debugger.Execute(in) {
+			sh.debugger = nil
+		}
+		return nil
+	}
+
 	if in == "help" {
-		return displayHelpCommand()
+		return displayHelpCommand(sh.out)
+	}
+
+	if c, ok := lookupShellCommand(in); ok {
+		return c.run(sh)
 	}
 	err := sh.runInstruction(in)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(sh.out, err)
+	}
+
+	return nil
+}
+
+// debug starts debugging the instructions which ran successfully so far as
+// one program, from an empty stack, until the quit command.
+func (sh *Shell) debug() error {
+	src := strings.Join(sh.lines, "\n")
+	pg, err := parser.NewParser(src).ParseProgram()
+	if err != nil {
+		return err
+	}
+
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.Stdout = sh.out
+	d, err := debugger.New(vm, pg, []byte(src))
+	if err != nil {
+		return err
 	}
 
+	d.Start(sh.out)
+	sh.debugger = d
 	return nil
 }
 
+// livePrefix returns the prompt of the debugger while debugging.
+func (sh *Shell) livePrefix() (string, bool) {
+	return debugger.PROMPT, sh.debugger != nil
+}
+
 func (sh *Shell) createStack() *evaluator.Stack {
 	return evaluator.NewStack()
 }
@@ -123,7 +170,7 @@ func (sh *Shell) execute(in string) {
 
 	err := sh.executeInput(in)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(sh.out, err)
 	}
 }
 
@@ -151,21 +198,23 @@ func (sh *Shell) completer(in prompt.Document) []prompt.Suggest {
 // Run start shell
 func Run(in io.Reader, out io.Writer) error {
 
-	var sh Shell
+	sh := Shell{out: out}
 
 	history, err := sh.loadHistory()
 	if err != nil {
 		return err
 	}
-	fmt.Println("Abstract VM")
-	fmt.Println("Enter \".help\" for usage hints.")
+	fmt.Fprintln(out, "Abstract VM")
+	fmt.Fprintln(out, "Enter \".help\" for usage hints.")
 	registerCommands()
-	sh.st = evaluator.NewStack()
+	sh.vm = evaluator.NewVM(evaluator.NewStack())
+	sh.vm.Stdout = out
 	e := prompt.New(sh.execute,
 		sh.completer,
 		prompt.OptionTitle("AVM"),
 		prompt.OptionPrefix(PROMPT),
 		prompt.OptionHistory(history),
+		prompt.OptionLivePrefix(sh.livePrefix),
 	)
 
 	e.Run()
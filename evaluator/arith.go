@@ -0,0 +1,278 @@
+package evaluator
+
+import (
+	"avm/token"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// ArithmeticMode defines how integer and floating point results that do not
+// fit in their type are handled.
+type ArithmeticMode uint8
+
+const (
+	// CheckedArithmetic returns an OverflowError or an UnderflowError.
+	CheckedArithmetic ArithmeticMode = iota
+	// WrappingArithmetic wraps integers around like two's complement
+	// hardware does and lets floating point values become infinite.
+	WrappingArithmetic
+	// SaturatingArithmetic clamps the result to the bounds of its type.
+	SaturatingArithmetic
+)
+
+// String returns the name of the mode.
+func (m ArithmeticMode) String() string {
+	switch m {
+	case CheckedArithmetic:
+		return "checked"
+	case WrappingArithmetic:
+		return "wrapping"
+	case SaturatingArithmetic:
+		return "saturating"
+	}
+
+	return ""
+}
+
+// integerRanges holds the bounds of each integer type.
+var integerRanges = map[ValueType][2]int64{
+	CharValue:    {math.MinInt8, math.MaxInt8},
+	ShortValue:   {math.MinInt16, math.MaxInt16},
+	IntegerValue: {math.MinInt32, math.MaxInt32},
+}
+
+// floatRanges holds the largest finite value of each floating point type.
+var floatRanges = map[ValueType]float64{
+	FloatValue:  math.MaxFloat32,
+	DoubleValue: math.MaxFloat64,
+}
+
+// newInteger returns r as a value of the integer type t, handling results
+// outside of the range of t according to the arithmetic mode of the VM.
+func (vm *VM) newInteger(op string, t ValueType, r int64) (Value, error) {
+	bounds := integerRanges[t]
+	switch {
+	case r > bounds[1]:
+		if vm.Mode == CheckedArithmetic {
+			return Value{}, &OverflowError{Op: op, Type: t}
+		}
+		if vm.Mode == SaturatingArithmetic {
+			r = bounds[1]
+		}
+	case r < bounds[0]:
+		if vm.Mode == CheckedArithmetic {
+			return Value{}, &UnderflowError{Op: op, Type: t}
+		}
+		if vm.Mode == SaturatingArithmetic {
+			r = bounds[0]
+		}
+	}
+
+	return truncateInteger(t, r), nil
+}
+
+// truncateInteger returns r as a value of the integer type t, keeping its low
+// bits only, which wraps the value around.
+func truncateInteger(t ValueType, r int64) Value {
+	switch t {
+	case CharValue:
+		return NewInt8Value(int8(r))
+	case ShortValue:
+		return NewInt16Value(int16(r))
+	}
+
+	return NewInt32Value(int32(r))
+}
+
+// newFloat returns r as a value of the floating point type t, handling
+// results outside of the range of t according to the arithmetic mode of the
+// VM.
+func (vm *VM) newFloat(op string, t ValueType, r float64) (Value, error) {
+	max := floatRanges[t]
+	switch {
+	case r > max:
+		if vm.Mode == CheckedArithmetic {
+			return Value{}, &OverflowError{Op: op, Type: t}
+		}
+		if vm.Mode == SaturatingArithmetic {
+			r = max
+		}
+	case r < -max:
+		if vm.Mode == CheckedArithmetic {
+			return Value{}, &UnderflowError{Op: op, Type: t}
+		}
+		if vm.Mode == SaturatingArithmetic {
+			r = -max
+		}
+	}
+
+	if t == FloatValue {
+		return NewFloatValue(float32(r)), nil
+	}
+
+	return NewDoubleValue(r), nil
+}
+
+// binaryOp implements an arithmetic instruction for each family of types.
+// Operands are promoted to the wider of their two types before being given
+// to the function of their family.
+type binaryOp struct {
+	name    string
+	integer func(a, b int64) (int64, error)
+	float   func(a, b float64) (float64, error)
+	decimal func(a, b *big.Rat) (*big.Rat, error)
+}
+
+var errIntegerDivideByZero = errors.New("error: integer divide by zero")
+
+var errDivideByZero = errors.New("error: division by zero")
+
+var addOp = binaryOp{
+	name:    token.ADD,
+	integer: func(a, b int64) (int64, error) { return a + b, nil },
+	float:   func(a, b float64) (float64, error) { return a + b, nil },
+	decimal: func(a, b *big.Rat) (*big.Rat, error) { return a.Add(a, b), nil },
+}
+
+var subOp = binaryOp{
+	name:    token.SUB,
+	integer: func(a, b int64) (int64, error) { return a - b, nil },
+	float:   func(a, b float64) (float64, error) { return a - b, nil },
+	decimal: func(a, b *big.Rat) (*big.Rat, error) { return a.Sub(a, b), nil },
+}
+
+var mulOp = binaryOp{
+	name:    token.MUL,
+	integer: func(a, b int64) (int64, error) { return a * b, nil },
+	float:   func(a, b float64) (float64, error) { return a * b, nil },
+	decimal: func(a, b *big.Rat) (*big.Rat, error) { return a.Mul(a, b), nil },
+}
+
+var divOp = binaryOp{
+	name: token.DIV,
+	integer: func(a, b int64) (int64, error) {
+		if b == 0 {
+			return 0, errIntegerDivideByZero
+		}
+		return a / b, nil
+	},
+	float: func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a / b, nil
+	},
+	decimal: func(a, b *big.Rat) (*big.Rat, error) {
+		if b.Sign() == 0 {
+			return nil, errDivideByZero
+		}
+		return a.Quo(a, b), nil
+	},
+}
+
+var modOp = binaryOp{
+	name: token.MOD,
+	integer: func(a, b int64) (int64, error) {
+		if b == 0 {
+			return 0, errIntegerDivideByZero
+		}
+		return a % b, nil
+	},
+	float: func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return math.Mod(a, b), nil
+	},
+	decimal: func(a, b *big.Rat) (*big.Rat, error) {
+		if b.Sign() == 0 {
+			return nil, errDivideByZero
+		}
+		return modDecimal(a, b), nil
+	},
+}
+
+// infixOps maps the operators of the expressions given to push and assert to
+// their arithmetic instruction.
+var infixOps = map[string]binaryOp{
+	token.PLUS:     addOp,
+	token.MINUS:    subOp,
+	token.ASTERISK: mulOp,
+	token.SLASH:    divOp,
+}
+
+// evalBinary replaces the first two values of the stack by the result of op
+// applied to them. The value at the top of the stack is the left operand.
+// They are left on the stack when op fails.
+func (vm *VM) evalBinary(op binaryOp) (Value, error) {
+	if vm.Stack.Size() < 2 {
+		return Value{}, fmt.Errorf("error: %s requires at least 2 values on the stack: got %d", op.name, vm.Stack.Size())
+	}
+
+	a, _ := vm.Stack.Peek(0)
+	b, _ := vm.Stack.Peek(1)
+	v, err := vm.applyBinary(op, a, b)
+	if err != nil {
+		return Value{}, err
+	}
+
+	vm.Stack.replace(2, v)
+	return v, nil
+}
+
+// applyBinary promotes a and b to the wider of their types and returns the
+// result of op, of that type.
+func (vm *VM) applyBinary(op binaryOp, a, b Value) (Value, error) {
+	t := GetBiggerType(a, b)
+	pa, err := a.Promote(t)
+	if err != nil {
+		return Value{}, err
+	}
+
+	pb, err := b.Promote(t)
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch t {
+	case CharValue, ShortValue, IntegerValue:
+		ia, _ := pa.ConvertToInteger()
+		ib, _ := pb.ConvertToInteger()
+		r, err := op.integer(int64(ia), int64(ib))
+		if err != nil {
+			return Value{}, err
+		}
+
+		return vm.newInteger(op.name, t, r)
+	case FloatValue, DoubleValue:
+		da, _ := pa.ConvertToDouble()
+		db, _ := pb.ConvertToDouble()
+		r, err := op.float(da, db)
+		if err != nil {
+			return Value{}, err
+		}
+
+		return vm.newFloat(op.name, t, r)
+	case BigDecimalValue:
+		r, err := op.decimal(pa.d, pb.d)
+		if err != nil {
+			return Value{}, err
+		}
+
+		return NewBigDecimalValue(r), nil
+	}
+
+	return Value{}, fmt.Errorf("unsupported type %s or %s", a.Type, b.Type)
+}
+
+// modDecimal returns the remainder of a / b truncated towards zero, so that
+// the result has the sign of a like the % operator and math.Mod.
+func modDecimal(a, b *big.Rat) *big.Rat {
+	q := new(big.Rat).Quo(a, b)
+	t := new(big.Int).Quo(q.Num(), q.Denom())
+	r := new(big.Rat).SetInt(t)
+	r.Mul(r, b)
+	return r.Sub(a, r)
+}
@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"avm/parser"
+	"io/ioutil"
+	"math/big"
+	"testing"
+)
+
+func BenchmarkStackPushPop(b *testing.B) {
+	st := NewStack()
+	v := NewInt32Value(42)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 1024; j++ {
+			_ = st.Push(v)
+		}
+		for j := 0; j < 1024; j++ {
+			_, _ = st.Pop()
+		}
+	}
+}
+
+func BenchmarkStackPeek(b *testing.B) {
+	st := NewStack()
+	for i := 0; i < 1<<16; i++ {
+		_ = st.Push(NewInt32Value(int32(i)))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = st.Peek(i & (1<<16 - 1))
+	}
+}
+
+func BenchmarkStackRoll(b *testing.B) {
+	st := NewStack()
+	for i := 0; i < 64; i++ {
+		_ = st.Push(NewInt8Value(int8(i)))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = st.Roll(63)
+	}
+}
+
+func benchmarkBinary(b *testing.B, op binaryOp, x, y Value) {
+	vm := NewVM(NewStack())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = vm.Stack.Push(y)
+		_ = vm.Stack.Push(x)
+		if _, err := vm.evalBinary(op); err != nil {
+			b.Fatal(err)
+		}
+		_, _ = vm.Stack.Pop()
+	}
+}
+
+func BenchmarkAddInt32(b *testing.B) {
+	benchmarkBinary(b, addOp, NewInt32Value(3), NewInt32Value(4))
+}
+
+func BenchmarkMulDouble(b *testing.B) {
+	benchmarkBinary(b, mulOp, NewDoubleValue(1.5), NewDoubleValue(2.5))
+}
+
+func BenchmarkAddBigDecimal(b *testing.B) {
+	benchmarkBinary(b, addOp, NewBigDecimalValue(big.NewRat(1, 3)), NewBigDecimalValue(big.NewRat(1, 7)))
+}
+
+// BenchmarkEvalLoop runs a program counting down from 1000, each iteration
+// executing 6 instructions.
+func BenchmarkEvalLoop(b *testing.B) {
+	pg, err := parser.NewParser("push int32(1000)\nloop:\npush int32(1)\nswap\nsub\ndup\njnz loop\npop").ParseProgram()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	vm := NewVM(NewStack())
+	vm.Stdout = ioutil.Discard
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := vm.Eval(pg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestArithmeticAllocations(t *testing.T) {
+	vm := NewVM(NewStack())
+	for _, op := range []binaryOp{addOp, subOp, mulOp, divOp, modOp} {
+		for _, v := range []Value{NewInt8Value(3), NewInt32Value(7), NewFloatValue(1.5), NewDoubleValue(2.5)} {
+			allocs := testing.AllocsPerRun(100, func() {
+				_ = vm.Stack.Push(v)
+				_ = vm.Stack.Push(v)
+				if _, err := vm.evalBinary(op); err != nil {
+					t.Fatal(err)
+				}
+				_, _ = vm.Stack.Pop()
+			})
+			if allocs != 0 {
+				t.Errorf("%s on %s: %v allocations, want 0", op.name, v.Type, allocs)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package evaluator
+
+import (
+	"avm/token"
+	"errors"
+	"fmt"
+)
+
+// integerBits holds the size in bits of each integer type.
+var integerBits = map[ValueType]uint{
+	CharValue:    8,
+	ShortValue:   16,
+	IntegerValue: 32,
+}
+
+var errNegativeShift = errors.New("error: negative shift count")
+
+// bitwiseOps implements the binary bitwise instructions on operands of the
+// integer type of the given size. The results are truncated to that size,
+// bits shifted out are lost and never overflow.
+var bitwiseOps = map[token.TokenType]func(a, b int64, bits uint) (int64, error){
+	token.AND: func(a, b int64, _ uint) (int64, error) { return a & b, nil },
+	token.OR:  func(a, b int64, _ uint) (int64, error) { return a | b, nil },
+	token.XOR: func(a, b int64, _ uint) (int64, error) { return a ^ b, nil },
+	token.SHL: func(a, b int64, bits uint) (int64, error) {
+		if b < 0 {
+			return 0, errNegativeShift
+		}
+		if b >= int64(bits) {
+			return 0, nil
+		}
+		return a << uint(b), nil
+	},
+	// shr fills the high bits with zeros, as if a was unsigned
+	token.SHR: func(a, b int64, bits uint) (int64, error) {
+		if b < 0 {
+			return 0, errNegativeShift
+		}
+		if b >= int64(bits) {
+			return 0, nil
+		}
+		u := uint64(a) & (1<<bits - 1)
+		return int64(u >> uint(b)), nil
+	},
+	// sar keeps the sign of a
+	token.SAR: func(a, b int64, bits uint) (int64, error) {
+		if b < 0 {
+			return 0, errNegativeShift
+		}
+		if b >= int64(bits) {
+			b = int64(bits) - 1
+		}
+		return a >> uint(b), nil
+	},
+}
+
+// evalBitwise applies a bitwise instruction to the integer values at the top
+// of the stack and stacks the result. not inverts the bits of the value at
+// the top of the stack, the others unstack the first two values, promoted
+// like for arithmetic instructions, the value at the top of the stack being
+// the left operand, e.g. the value to shift. The operands are left on the
+// stack when the instruction fails.
+func (vm *VM) evalBitwise(op token.TokenType) (Value, error) {
+	name := string(op)
+	if op == token.NOT {
+		if vm.Stack.IsEmpty() {
+			return Value{}, fmt.Errorf("error: %s on empty stack", name)
+		}
+
+		a, _ := vm.Stack.Peek(0)
+
+		bits, ok := integerBits[a.Type]
+		if !ok {
+			return Value{}, &TypeError{Op: name, Type: a.Type, Want: "integer operands"}
+		}
+
+		ia, _ := a.ConvertToInteger()
+		v := truncateInteger(a.Type, ^int64(ia)&(1<<bits-1))
+		vm.Stack.replace(1, v)
+		return v, nil
+	}
+
+	fn, ok := bitwiseOps[op]
+	if !ok {
+		return Value{}, fmt.Errorf("error: unknown bitwise instruction %s", name)
+	}
+
+	if vm.Stack.Size() < 2 {
+		return Value{}, fmt.Errorf("error: %s requires at least 2 values on the stack: got %d", name, vm.Stack.Size())
+	}
+
+	a, _ := vm.Stack.Peek(0)
+	b, _ := vm.Stack.Peek(1)
+	t := GetBiggerType(a, b)
+	bits, ok := integerBits[t]
+	if !ok {
+		return Value{}, &TypeError{Op: name, Type: t, Want: "integer operands"}
+	}
+
+	pa, err := a.Promote(t)
+	if err != nil {
+		return Value{}, err
+	}
+
+	pb, err := b.Promote(t)
+	if err != nil {
+		return Value{}, err
+	}
+
+	ia, _ := pa.ConvertToInteger()
+	ib, _ := pb.ConvertToInteger()
+	r, err := fn(int64(ia), int64(ib), bits)
+	if err != nil {
+		return Value{}, err
+	}
+
+	v := truncateInteger(t, r)
+	vm.Stack.replace(2, v)
+	return v, nil
+}
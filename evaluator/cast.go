@@ -0,0 +1,150 @@
+package evaluator
+
+import (
+	"avm/ast"
+	"avm/token"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// LookupType returns the type named name, e.g. IntegerValue for int32.
+func LookupType(name string) (ValueType, bool) {
+	for t := range promotionRank {
+		if t.String() == name {
+			return t, true
+		}
+	}
+
+	return 0, false
+}
+
+// Cast returns v converted to the type t, which can be narrower than the type
+// of v. Floating point and bigdecimal values are truncated towards zero when
+// converted to an integer type and rounded to the nearest value when
+// converted to float or double. Unlike arithmetic results, a value which does
+// not fit in t is always an error: an OverflowError or an UnderflowError.
+func (v Value) Cast(t ValueType) (Value, error) {
+	if _, ok := promotionRank[t]; !ok {
+		return Value{}, fmt.Errorf("error: cannot cast to unknown type %d", t)
+	}
+
+	if v.Type == t {
+		return v, nil
+	}
+
+	// widening never loses the value, except for int32 into float which is
+	// rounded like any conversion to float
+	if promotionRank[t] > promotionRank[v.Type] {
+		d, err := v.ConvertToDouble()
+		if t == BigDecimalValue && err == nil && (math.IsNaN(d) || math.IsInf(d, 0)) {
+			return Value{}, fmt.Errorf("error: cannot cast %s to %s", v.Literal(), t)
+		}
+
+		return v.Promote(t)
+	}
+
+	switch v.Type {
+	case FloatValue, DoubleValue:
+		d := v.f
+		if t == FloatValue {
+			return castFloat(d)
+		}
+
+		if math.IsNaN(d) {
+			return Value{}, fmt.Errorf("error: cannot cast NaN to %s", t)
+		}
+
+		switch {
+		case d >= math.MaxInt64:
+			return Value{}, &OverflowError{Op: token.CAST, Type: t}
+		case d <= math.MinInt64:
+			return Value{}, &UnderflowError{Op: token.CAST, Type: t}
+		}
+
+		return castInteger(t, int64(math.Trunc(d)))
+	case BigDecimalValue:
+		x := v.d
+		switch t {
+		case FloatValue:
+			f, _ := x.Float32()
+			if math.IsInf(float64(f), 0) {
+				return Value{}, rangeError(t, float64(f))
+			}
+			return NewFloatValue(f), nil
+		case DoubleValue:
+			f, _ := x.Float64()
+			if math.IsInf(f, 0) {
+				return Value{}, rangeError(t, f)
+			}
+			return NewDoubleValue(f), nil
+		}
+
+		// big.Int.Quo truncates towards zero
+		i := new(big.Int).Quo(x.Num(), x.Denom())
+		if !i.IsInt64() {
+			return Value{}, rangeError(t, float64(i.Sign()))
+		}
+
+		return castInteger(t, i.Int64())
+	}
+
+	return castInteger(t, v.i)
+}
+
+// castInteger returns i as a value of the integer type t.
+func castInteger(t ValueType, i int64) (Value, error) {
+	bounds := integerRanges[t]
+	if i < bounds[0] || i > bounds[1] {
+		return Value{}, rangeError(t, float64(i))
+	}
+
+	return truncateInteger(t, i), nil
+}
+
+// castFloat returns d rounded to the nearest float.
+func castFloat(d float64) (Value, error) {
+	if !math.IsInf(d, 0) && math.Abs(d) > math.MaxFloat32 {
+		return Value{}, rangeError(FloatValue, d)
+	}
+
+	return NewFloatValue(float32(d)), nil
+}
+
+// rangeError returns the error of a cast to t of a value whose sign is the
+// sign of x.
+func rangeError(t ValueType, x float64) error {
+	if x < 0 {
+		return &UnderflowError{Op: token.CAST, Type: t}
+	}
+
+	return &OverflowError{Op: token.CAST, Type: t}
+}
+
+// evalCast replaces the value at the top of the stack by its conversion to
+// the type of the instruction. The value is left on the stack when it cannot
+// be converted.
+func (vm *VM) evalCast(stmt *ast.CastStatement) (Value, error) {
+	t, ok := LookupType(stmt.Type.Value)
+	if !ok {
+		return Value{}, fmt.Errorf("error: unknown type %s", stmt.Type.Value)
+	}
+
+	return vm.cast(t)
+}
+
+// cast replaces the value at the top of the stack by its conversion to t.
+func (vm *VM) cast(t ValueType) (Value, error) {
+	if vm.Stack.IsEmpty() {
+		return Value{}, fmt.Errorf("error: %s on empty stack", token.CAST)
+	}
+
+	a, _ := vm.Stack.Peek(0)
+	v, err := a.Cast(t)
+	if err != nil {
+		return Value{}, err
+	}
+
+	vm.Stack.replace(1, v)
+	return v, nil
+}
@@ -0,0 +1,190 @@
+package evaluator
+
+import (
+	"avm/token"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Instruction is a single compiled instruction.
+type Instruction struct {
+	Op      Opcode
+	Operand int            // index of the constant, label or variable, type or count of the instruction
+	Pos     token.Position // position of the instruction in the source
+}
+
+// Label names the instruction a jump or a call goes to.
+type Label struct {
+	Name string
+	PC   int // index of the instruction in the code, which can be its length
+}
+
+// Code is a compiled program, run by VM.RunCode. The operand of each
+// instruction is an index in Constants, Labels or Variables, a type or a
+// count, depending on its opcode.
+type Code struct {
+	Filename     string
+	Constants    []Value
+	Labels       []Label
+	Variables    []string
+	Instructions []Instruction
+}
+
+// pos returns the position of ins in the source of the program.
+func (c *Code) pos(ins Instruction) token.Position {
+	pos := ins.Pos
+	pos.Filename = c.Filename
+	return pos
+}
+
+// text returns ins as it is written in the source, e.g. push int32(42).
+func (c *Code) text(ins Instruction) string {
+	switch {
+	case ins.Op == OpPush || ins.Op == OpAssert:
+		v := c.Constants[ins.Operand]
+		return fmt.Sprintf("%s %s(%s)", ins.Op, v.Type, v.Literal())
+	case ins.Op.HasLabel():
+		return ins.Op.String() + " " + c.Labels[ins.Operand].Name
+	case ins.Op.HasVariable():
+		return ins.Op.String() + " " + c.Variables[ins.Operand]
+	case ins.Op.HasType():
+		return ins.Op.String() + " " + ValueType(ins.Operand).String()
+	case ins.Op.HasCount():
+		return ins.Op.String() + " " + strconv.Itoa(ins.Operand)
+	}
+
+	return ins.Op.String()
+}
+
+// RunCode runs a compiled program from its first instruction, dispatching on
+// the opcode of each one, and returns the value of the last one. Like
+// EvalContext, the program is stopped with a HaltError when ctx is done, or
+// when it exceeds MaxInstructions or Timeout, and a failing instruction is
+// returned as a *RuntimeError.
+func (vm *VM) RunCode(ctx context.Context, code *Code) (Value, error) {
+	if vm.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vm.Timeout)
+		defer cancel()
+	}
+
+	vm.stmts = nil
+	vm.labels = nil
+	vm.pc = 0
+	vm.returns = vm.returns[:0]
+
+	var v Value
+	for executed := 0; vm.pc < len(code.Instructions); executed++ {
+		if err := ctx.Err(); err != nil {
+			return v, &HaltError{Pos: code.pos(code.Instructions[vm.pc]), Executed: executed, Err: err}
+		}
+
+		if vm.MaxInstructions > 0 && executed >= vm.MaxInstructions {
+			return v, &HaltError{Pos: code.pos(code.Instructions[vm.pc]), Executed: executed, Err: ErrInstructionLimit}
+		}
+
+		var err error
+		if v, err = vm.stepCode(code); err != nil {
+			return v, err
+		}
+	}
+
+	return v, nil
+}
+
+// stepCode executes the instruction of code at the program counter, like
+// Step executes a statement.
+func (vm *VM) stepCode(code *Code) (Value, error) {
+	ins := code.Instructions[vm.pc]
+	vm.pc++
+	depth := vm.Stack.Size()
+	if vm.Debug {
+		vm.debugf("%s: %s (stack depth %d)", code.pos(ins), code.text(ins), depth)
+	}
+
+	var before *TraceValue
+	if vm.Trace != nil {
+		before = vm.top()
+	}
+
+	var start time.Time
+	if vm.Profile != nil {
+		start = time.Now()
+	}
+
+	v, err := vm.execute(code, ins)
+	if vm.Profile != nil {
+		vm.Profile.record(code.pos(ins), ins.Op.String(), code.text(ins), start, time.Since(start), vm.Stack.Size())
+	}
+
+	if vm.Trace != nil {
+		vm.trace(code.pos(ins), code.text(ins), before, err)
+	}
+
+	if err == nil || err == ErrExit {
+		return v, err
+	}
+
+	return v, &RuntimeError{Pos: code.pos(ins), Instruction: code.text(ins), Depth: depth, Err: err}
+}
+
+// execute runs a compiled instruction. The instructions taking a token type
+// are given the name of the opcode, which is the type of its token.
+func (vm *VM) execute(code *Code, ins Instruction) (Value, error) {
+	op := token.TokenType(ins.Op.String())
+	switch ins.Op {
+	case OpPush:
+		return vm.push(code.Constants[ins.Operand])
+	case OpAssert:
+		return vm.assert(code.Constants[ins.Operand])
+	case OpPop:
+		return vm.Stack.Pop()
+	case OpDump:
+		return Value{}, vm.Stack.Dump(vm.Stdout)
+	case OpClear:
+		vm.Stack.Clear()
+		return Value{}, nil
+	case OpDup:
+		return vm.evalDup()
+	case OpSwap:
+		return vm.evalSwap()
+	case OpPrint:
+		return vm.evalPrint()
+	case OpExit:
+		return Value{}, ErrExit
+	case OpAdd:
+		return vm.evalBinary(addOp)
+	case OpSub:
+		return vm.evalBinary(subOp)
+	case OpMul:
+		return vm.evalBinary(mulOp)
+	case OpDiv:
+		return vm.evalBinary(divOp)
+	case OpMod:
+		return vm.evalBinary(modOp)
+	case OpJmp, OpJz, OpJnz, OpJlt, OpJgt:
+		return vm.jump(op, code.Labels[ins.Operand].PC)
+	case OpCall:
+		return vm.call(code.Labels[ins.Operand].PC)
+	case OpRet:
+		return vm.evalRet()
+	case OpStore:
+		return vm.evalStore(code.Variables[ins.Operand])
+	case OpLoad:
+		return vm.evalLoad(code.Variables[ins.Operand])
+	case OpEq, OpNeq, OpLt, OpLe, OpGt, OpGe:
+		return vm.evalCompare(op)
+	case OpAnd, OpOr, OpXor, OpNot, OpShl, OpShr, OpSar:
+		return vm.evalBitwise(op)
+	case OpNeg, OpAbs, OpMin, OpMax, OpPow, OpSqrt, OpExp, OpLog, OpSin, OpCos:
+		return vm.evalMath(op)
+	case OpCast:
+		return vm.cast(ValueType(ins.Operand))
+	case OpOver, OpRot, OpPick, OpRoll, OpDrop, OpDepth:
+		return vm.evalStack(op, ins.Operand)
+	}
+
+	return Value{}, fmt.Errorf("error: unknown opcode %d", byte(ins.Op))
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"avm/token"
+	"fmt"
+	"math"
+)
+
+// compareOps tells for each comparison instruction whether it holds given
+// the ordering of its operands: -1, 0 or 1.
+var compareOps = map[token.TokenType]func(c int) bool{
+	token.CMPEQ:  func(c int) bool { return c == 0 },
+	token.CMPNEQ: func(c int) bool { return c != 0 },
+	token.CMPLT:  func(c int) bool { return c < 0 },
+	token.CMPLE:  func(c int) bool { return c <= 0 },
+	token.CMPGT:  func(c int) bool { return c > 0 },
+	token.CMPGE:  func(c int) bool { return c >= 0 },
+}
+
+// evalCompare unstacks the first two values of the stack and compares them,
+// the value at the top of the stack being the left operand like for
+// arithmetic instructions. It stacks int8(1) when the comparison holds and
+// int8(0) otherwise. The values are left on the stack when they cannot be
+// compared.
+func (vm *VM) evalCompare(op token.TokenType) (Value, error) {
+	holds, ok := compareOps[op]
+	if !ok {
+		return Value{}, fmt.Errorf("error: unknown comparison %s", op)
+	}
+
+	if vm.Stack.Size() < 2 {
+		return Value{}, fmt.Errorf("error: %s requires at least 2 values on the stack: got %d", op, vm.Stack.Size())
+	}
+
+	a, _ := vm.Stack.Peek(0)
+	b, _ := vm.Stack.Peek(1)
+	c, ordered, err := compareValues(a, b)
+	if err != nil {
+		return Value{}, err
+	}
+
+	// NaN is neither lower, equal nor greater than any value
+	var r int8
+	if (ordered && holds(c)) || (!ordered && op == token.CMPNEQ) {
+		r = 1
+	}
+
+	v := NewInt8Value(r)
+	vm.Stack.replace(2, v)
+	return v, nil
+}
+
+// compareValues promotes a and b to the wider of their types and returns -1,
+// 0 or 1 when a is lower than, equal to or greater than b. ordered is false
+// when one of them is NaN.
+func compareValues(a, b Value) (c int, ordered bool, err error) {
+	t := GetBiggerType(a, b)
+	pa, err := a.Promote(t)
+	if err != nil {
+		return 0, false, err
+	}
+
+	pb, err := b.Promote(t)
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch t {
+	case CharValue, ShortValue, IntegerValue:
+		ia, _ := pa.ConvertToInteger()
+		ib, _ := pb.ConvertToInteger()
+		return compareFloats(float64(ia), float64(ib)), true, nil
+	case FloatValue, DoubleValue:
+		da, _ := pa.ConvertToDouble()
+		db, _ := pb.ConvertToDouble()
+		if math.IsNaN(da) || math.IsNaN(db) {
+			return 0, false, nil
+		}
+
+		return compareFloats(da, db), true, nil
+	case BigDecimalValue:
+		return pa.d.Cmp(pb.d), true, nil
+	}
+
+	return 0, false, fmt.Errorf("unsupported type %s or %s", a.Type, b.Type)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"avm/token"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUndefinedLabel is wrapped in the LabelError of a jump to a label
+	// which is not defined.
+	ErrUndefinedLabel = errors.New("undefined label")
+
+	// ErrDuplicateLabel is wrapped in the LabelError of a label defined more
+	// than once.
+	ErrDuplicateLabel = errors.New("duplicate label")
+
+	// ErrDomain is wrapped in the error of a math instruction applied to a
+	// value outside of its domain, such as the square root of a negative
+	// value.
+	ErrDomain = errors.New("domain error")
+)
+
+// RuntimeError is returned when an instruction of a program fails.
+type RuntimeError struct {
+	Pos         token.Position // position of the failing instruction
+	Instruction string         // text of the failing instruction
+	Depth       int            // stack size before the instruction ran
+	Err         error
+}
+
+// Error returns the string representation of the error.
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s: %s: %s (stack depth %d)", e.Pos, e.Instruction, e.Err, e.Depth)
+}
+
+// Unwrap returns the underlying error.
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// HaltError is returned when a program is stopped before its end, because it
+// was canceled or exceeded one of the limits of the VM.
+type HaltError struct {
+	Pos      token.Position // position of the first instruction not executed
+	Executed int            // number of instructions executed
+	Err      error          // ErrInstructionLimit or the error of the context
+}
+
+// Error returns the string representation of the error.
+func (e *HaltError) Error() string {
+	return fmt.Sprintf("%s: halted after %d instructions: %s", e.Pos, e.Executed, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *HaltError) Unwrap() error {
+	return e.Err
+}
+
+// LabelError is returned when the labels of a program cannot be resolved.
+type LabelError struct {
+	Pos   token.Position // position of the jump or of the label
+	Label string
+	Err   error // ErrUndefinedLabel or ErrDuplicateLabel
+}
+
+// Error returns the string representation of the error.
+func (e *LabelError) Error() string {
+	return fmt.Sprintf("%s: error: %s %q", e.Pos, e.Err, e.Label)
+}
+
+// Unwrap returns the underlying error.
+func (e *LabelError) Unwrap() error {
+	return e.Err
+}
+
+// TypeError is returned when an instruction is applied to a value whose type
+// it does not support.
+type TypeError struct {
+	Op   string
+	Type ValueType
+	Want string // what the instruction requires, e.g. "integer operands"
+}
+
+// Error returns the string representation of the error.
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("error: %s requires %s: got %s", e.Op, e.Want, e.Type)
+}
+
+// StackOverflowError is returned when a value is pushed on a full stack.
+type StackOverflowError struct {
+	MaxDepth int
+}
+
+// Error returns the string representation of the error.
+func (e *StackOverflowError) Error() string {
+	return fmt.Sprintf("error: stack overflow: the maximum depth of %d values is reached", e.MaxDepth)
+}
+
+// OverflowError is returned when the result of an operation is greater than
+// the largest value of its type.
+type OverflowError struct {
+	Op   string
+	Type ValueType
+}
+
+// Error returns the string representation of the error.
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("error: %s overflow on %s", e.Type, e.Op)
+}
+
+// UnderflowError is returned when the result of an operation is lower than
+// the smallest value of its type.
+type UnderflowError struct {
+	Op   string
+	Type ValueType
+}
+
+// Error returns the string representation of the error.
+func (e *UnderflowError) Error() string {
+	return fmt.Sprintf("error: %s underflow on %s", e.Type, e.Op)
+}
@@ -1,687 +1,228 @@
 package evaluator
 
 import (
-	"avm/ast"
-	"avm/token"
 	"errors"
 	"fmt"
-	"math"
+	"io"
 )
 
-type Node struct {
-	v    Value
-	next *Node
-}
+// DefaultMaxDepth is the number of values a new stack can hold.
+const DefaultMaxDepth = 1 << 20
 
+// Stack holds the values of the VM. The values are stored contiguously, the
+// top of the stack being the last one, so that pushing and popping do not
+// allocate once the stack has grown.
 type Stack struct {
-	head *Node
-	size int
+	values []Value
+	max    int // maximum depth, 0 means unlimited
 }
 
+// NewStack returns an empty stack which can hold DefaultMaxDepth values.
 func NewStack() *Stack {
-	s := &Stack{nil, 0}
+	s := &Stack{max: DefaultMaxDepth}
 	return s
 }
 
 func (s *Stack) Size() int {
-	return s.size
+	return len(s.values)
 }
 
-func (s *Stack) Push(v Value) {
-	s.head = &Node{v: v, next: s.head}
-	s.size++
+// MaxDepth returns the number of values the stack can hold, 0 meaning
+// unlimited.
+func (s *Stack) MaxDepth() int {
+	return s.max
 }
 
-func (s *Stack) Pop() (Value, error) {
-	if s.IsEmpty() {
-		return Value{}, errors.New("error: pop on empty stack")
-	}
-
-	v := s.head.v
-	s.head = s.head.next
-	s.size--
-	return v, nil
+// SetMaxDepth sets the number of values the stack can hold, 0 meaning
+// unlimited. The values already on the stack are kept even when they exceed
+// the new depth, but nothing more can be pushed until enough are removed.
+func (s *Stack) SetMaxDepth(n int) {
+	s.max = n
 }
 
-func (s *Stack) Clear() {
-	if s.IsEmpty() {
-		return
-	}
-	temp := s.head
-	for temp != nil {
-		_, _ = s.Pop()
-		temp = temp.next
-	}
+// full reports whether pushing another value would exceed the maximum depth.
+func (s *Stack) full() bool {
+	return s.max > 0 && len(s.values) >= s.max
 }
 
-func (s *Stack) IsEmpty() bool {
-	return s.size == 0
+// index returns the position in s.values of the value at the index i, 0
+// being the top of the stack.
+func (s *Stack) index(i int) int {
+	return len(s.values) - 1 - i
 }
 
-func (s *Stack) Dup() {
-	if s.IsEmpty() {
-		return
+// Push stacks v, or returns a StackOverflowError when the stack is full.
+func (s *Stack) Push(v Value) error {
+	if s.full() {
+		return &StackOverflowError{MaxDepth: s.max}
 	}
 
-	dup := s.head.v
-	s.Push(dup)
+	s.values = append(s.values, v)
+	return nil
 }
 
-// Dump display each value on the stack.
-func (s *Stack) Dump() (Value, error) {
-	tmp := s.head
-	for tmp != nil {
-		fmt.Println(tmp.v)
-		tmp = tmp.next
+func (s *Stack) Pop() (Value, error) {
+	if s.IsEmpty() {
+		return Value{}, errors.New("error: pop on empty stack")
 	}
-	fmt.Println()
 
-	return Value{}, nil
+	n := len(s.values) - 1
+	v := s.values[n]
+	// release what the value refers to, e.g. the *big.Rat of a bigdecimal
+	s.values[n] = Value{}
+	s.values = s.values[:n]
+	return v, nil
 }
 
-func (s *Stack) Swap() error {
-	if s.size < 2 {
-		return fmt.Errorf("error: Swap require stack size greater than 2: got %d", s.size)
-	}
-
-	a, _ := s.Pop()
-	b, _ := s.Pop()
-	s.Push(a)
-	s.Push(b)
-	return nil
+func (s *Stack) Clear() {
+	s.truncate(0)
 }
 
-func (s *Stack) InsertAt(p int, v Value) error {
-	if p < 0 || p > s.size {
-		return fmt.Errorf("index %d out of range", p)
-	}
-
-	st := NewStack()
-	temp := s.head
-	i := 0
-	for temp != nil {
-		if i == p {
-			s.Push(v)
-			break
-		}
-
-		va, err := s.Pop()
-		if err != nil {
-			return err
-		}
-
-		st.Push(va)
-		temp = temp.next
-		i++
+// truncate removes the values above the first n ones from the bottom.
+func (s *Stack) truncate(n int) {
+	for i := n; i < len(s.values); i++ {
+		s.values[i] = Value{}
 	}
 
-	temp = st.head
-	for temp != nil {
-		va, err := st.Pop()
-		if err != nil {
-			return err
-		}
-
-		s.Push(va)
-		temp = temp.next
-	}
-
-	return nil
+	s.values = s.values[:n]
 }
 
-func (s *Stack) Peek(index int) (Value, error) {
-	//stack size is between 0-15
-	if index < 0 || index > 15 {
-		return Value{}, fmt.Errorf("index %d out of range", index)
-	}
-
-	tmp := s.head
-	i := 0
-	for tmp != nil {
-		if i == index {
-			return tmp.v, nil
-		}
-
-		i++
-		tmp = tmp.next
-	}
-
-	return Value{}, fmt.Errorf("no value at index %d", index)
+// replace removes the first n values of the stack, n being at least 1, and
+// stacks v in their place. It is used once an instruction has succeeded so
+// that a failing instruction leaves its operands on the stack.
+func (s *Stack) replace(n int, v Value) {
+	s.truncate(len(s.values) - n)
+	s.values = append(s.values, v)
 }
 
-func (s *Stack) Eval(node ast.Node) (Value, error) {
-	switch n := node.(type) {
-	case *ast.Program:
-		return s.evalStatements(n.Statements)
-	case *ast.PushStatement:
-		return s.evalPushStatement(n)
-	case *ast.AddStatement:
-		return s.evalAdd()
-	case *ast.AssertStatement:
-		return s.evalAssert(n)
-	case *ast.MulStatement:
-		return s.evalMul()
-	case *ast.DivStatement:
-		return s.evalDiv()
-	case *ast.ModStatement:
-		return s.evalMod()
-	case *ast.DumpStatement:
-		return s.Dump()
-	case *ast.PopStatement:
-		return s.Pop()
-	case *ast.ExpressionStatement:
-		return s.Eval(n.Expression)
-	case *ast.IntegerLiteral:
-		return Value{V: n.IntValue, Type: IntegerValue}, nil
-	case *ast.InfixExpression:
-		left, err := s.Eval(n.Left)
-		if err != nil {
-			return Value{}, err
-		}
-		right, err := s.Eval(n.Right)
-		if err != nil {
-			return Value{}, err
-		}
-		return evalInfixExpression(n.Operator, left, right)
-	default:
-		return Value{}, fmt.Errorf("unknown instruction ")
+// Values returns the values on the stack, from the top to the bottom.
+func (s *Stack) Values() []Value {
+	values := make([]Value, 0, len(s.values))
+	for i := len(s.values) - 1; i >= 0; i-- {
+		values = append(values, s.values[i])
 	}
 
+	return values
 }
 
-func evalIntegerInfixExpression(op string, left, right Value) (Value, error) {
-
-	leftVal, err := left.ConvertToInteger()
-	if err != nil {
-		return left, err
-	}
-	rightVal, err := right.ConvertToInteger()
-	if err != nil {
-		return right, err
-	}
-	switch op {
-	case token.PLUS:
-		return NewInt32Value(leftVal + rightVal), nil
-	case token.MINUS:
-		return NewInt32Value(leftVal - rightVal), nil
-
-	case token.ASTERISK:
-		return NewInt32Value(leftVal * rightVal), nil
-	case token.SLASH:
-		return NewInt32Value(leftVal / rightVal), nil
-	default:
-		return Value{}, fmt.Errorf("no infix evaluator for %q\n", op)
-	}
-}
-
-func evalInfixExpression(op string, left, right Value) (Value, error) {
-	return evalIntegerInfixExpression(op, left, right)
+func (s *Stack) IsEmpty() bool {
+	return len(s.values) == 0
 }
 
-func (s *Stack) evalStatements(stmts []ast.Statement) (Value, error) { return s.Eval(stmts[0]) }
-
-func convertAstToValue(n string, expr ast.Expression) (Value, error) {
-	switch {
-	case n == token.INT32:
-		value := expr.(*ast.IntegerLiteral)
-		v := NewInt32Value(value.IntValue)
-		return v, nil
-	case n == token.INT8:
-		value := expr.(*ast.ByteLiteral)
-		v := NewInt8Value(value.ByteValue)
-		return v, nil
-	case n == token.INT16:
-		value := expr.(*ast.ShortLiteral)
-		v := NewInt16Value(value.ShortValue)
-		return v, nil
-	case n == token.FLOAT:
-		value := expr.(*ast.FloatLiteral)
-		v := NewFloatValue(value.FloatValue)
-		return v, nil
-	case n == token.DOUBLE:
-		value := expr.(*ast.DoubleLiteral)
-		v := NewDoubleValue(value.DoubleValue)
-		return v, nil
+func (s *Stack) Dup() error {
+	if s.IsEmpty() {
+		return errors.New("error: dup on empty stack")
 	}
 
-	return Value{}, fmt.Errorf("bad statement %s", n)
+	dup := s.values[len(s.values)-1]
+	return s.Push(dup)
 }
 
-func (s *Stack) evalPushStatement(stmt *ast.PushStatement) (Value, error) {
-	fmt.Printf("Here: %T\n", stmt.Value)
-	v := Value{}
-	var err error
-	switch stmt.Value.(type) {
-	case *ast.InfixExpression:
-		v, err = s.Eval(stmt.Value)
-		if err != nil {
-			return Value{}, err
-		}
-		break
-	default:
-		v, err = convertAstToValue(stmt.Name.String(), stmt.Value)
-		if err != nil {
-			return Value{}, err
+// Dump writes each value on the stack to w.
+func (s *Stack) Dump(w io.Writer) error {
+	for i := len(s.values) - 1; i >= 0; i-- {
+		if _, err := fmt.Fprintln(w, s.values[i]); err != nil {
+			return err
 		}
-
 	}
 
-
-	s.Push(v)
-	return v, nil
+	_, err := fmt.Fprintln(w)
+	return err
 }
 
-func (s *Stack) evalAdd() (Value, error) {
-	if s.size < 2 {
-		return Value{}, fmt.Errorf("stack size must be greater than 2: got %d", s.size)
-	}
-
-	a, _ := s.Pop()
-	b, _ := s.Pop()
-	switch GetBiggerType(a, b) {
-	case CharValue:
-		ca, err := a.ConvertToChar()
-		if err != nil {
-			return a, err
-		}
-
-		cb, err := b.ConvertToChar()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewInt8Value(ca + cb)
-		s.Push(v)
-		return v, nil
-	case ShortValue:
-		sa, err := a.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-		sb, err := b.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-
-		v := NewInt16Value(sa + sb)
-		s.Push(v)
-		return v, nil
-	case IntegerValue:
-		ia, err := a.ConvertToInteger()
-		if err != nil {
-			return a, err
-		}
-
-		ib, err := b.ConvertToInteger()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewInt32Value(ia + ib)
-		s.Push(v)
-		return v, nil
-	case FloatValue:
-		fa, err := a.ConvertToFloat()
-		if err != nil {
-			return a, err
-		}
-
-		fb, err := b.ConvertToFloat()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewFloatValue(fa + fb)
-		s.Push(v)
-		return v, nil
-	case DoubleValue:
-		da, err := a.ConvertToDouble()
-		if err != nil {
-			return a, err
-		}
-
-		db, err := b.ConvertToDouble()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewDoubleValue(da + db)
-		s.Push(v)
-		return v, nil
+func (s *Stack) Swap() error {
+	if len(s.values) < 2 {
+		return fmt.Errorf("error: Swap require stack size greater than 2: got %d", len(s.values))
 	}
 
-	return Value{}, fmt.Errorf("unsupported type %s or %s", a.Type, b.Type)
+	a, b := s.index(0), s.index(1)
+	s.values[a], s.values[b] = s.values[b], s.values[a]
+	return nil
 }
 
-func (s *Stack) evalAssert(stmt *ast.AssertStatement) (Value, error) {
-	fmt.Printf("Here: %T\n", stmt.Value)
-	v := Value{}
-	var err error
-	switch stmt.Value.(type) {
-	case *ast.InfixExpression:
-		v, err = s.Eval(stmt.Value)
-		if err != nil {
-			return Value{}, err
-		}
-		break
-	default:
-		v, err = convertAstToValue(stmt.Name.String(), stmt.Value)
-		if err != nil {
-			return Value{}, err
-		}
-
+// InsertAt inserts v at the index p, 0 being the top of the stack and the
+// size of the stack its bottom.
+func (s *Stack) InsertAt(p int, v Value) error {
+	if p < 0 || p > len(s.values) {
+		return fmt.Errorf("index %d out of range", p)
 	}
 
-	fmt.Printf("left:: %v  \n", v)
-	if s.IsEmpty() {
-		return Value{}, errors.New("cannot check value empty stack")
+	if s.full() {
+		return &StackOverflowError{MaxDepth: s.max}
 	}
 
-	res := s.head
+	i := len(s.values) - p
+	s.values = append(s.values, Value{})
+	copy(s.values[i+1:], s.values[i:])
+	s.values[i] = v
+	return nil
+}
 
-	if res.v.V == v.V && res.v.Type == v.Type {
-		return v, nil
+// RemoveAt removes the value at the index p, 0 being the top of the stack,
+// and returns it.
+func (s *Stack) RemoveAt(p int) (Value, error) {
+	if p < 0 || p >= len(s.values) {
+		return Value{}, fmt.Errorf("index %d out of range", p)
 	}
 
-	return v, fmt.Errorf("expected %s(%v) stack contains  %s(%v)", v.Type, v.V, res.v.Type, res.v.V)
+	i := s.index(p)
+	v := s.values[i]
+	copy(s.values[i:], s.values[i+1:])
+	s.truncate(len(s.values) - 1)
+	return v, nil
 }
 
-func (s *Stack) evalMod() (Value, error) {
-	a, err := s.Pop()
-	if err != nil {
-		return Value{}, err
-	}
-
-	b, err := s.Pop()
-	if err != nil {
-		return Value{}, err
+// Peek returns the value at the index, 0 being the top of the stack. An index
+// beyond the maximum depth of the stack is a StackOverflowError.
+func (s *Stack) Peek(index int) (Value, error) {
+	if s.max > 0 && index >= s.max {
+		return Value{}, &StackOverflowError{MaxDepth: s.max}
 	}
 
-	switch GetBiggerType(a, b) {
-	case CharValue:
-		ca, err := a.ConvertToChar()
-		if err != nil {
-			return a, err
-		}
-
-		cb, err := b.ConvertToChar()
-		if err != nil {
-			return b, err
-		}
-
-		// if the divisor by 0 returns error
-		if cb == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-
-		v := NewInt8Value(ca % cb)
-		s.Push(v)
-		return v, nil
-	case ShortValue:
-		sa, err := a.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-		sb, err := b.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-
-		if sb == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-		v := NewInt16Value(int16(sa % sb))
-		s.Push(v)
-		return v, nil
-	case IntegerValue:
-		ia, err := a.ConvertToInteger()
-		if err != nil {
-			return a, err
-		}
-
-		ib, err := b.ConvertToInteger()
-		if err != nil {
-			return b, err
-		}
-
-		if b.V.(int32) == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-
-		v := NewInt32Value(ia % ib)
-		s.Push(v)
-		return v, nil
-	case FloatValue:
-		fa, err := a.ConvertToFloat()
-		if err != nil {
-			return a, err
-		}
-
-		fb, err := b.ConvertToFloat()
-		if err != nil {
-			return b, err
-		}
-
-		if b.V.(float32) == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-
-		f := math.Mod(float64(fa), float64(fb))
-		f = math.Round(f * math.Pow10(2)) / math.Pow10(2)
-		v := NewFloatValue(float32(f))
-		s.Push(v)
-		return v, nil
-	case DoubleValue:
-		da, err := a.ConvertToDouble()
-		if err != nil {
-			return a, err
-		}
-
-		db, err := b.ConvertToDouble()
-		if err != nil {
-			return b, err
-		}
-
-		if b.V.(float64) == 0 || a.V.(float64) == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-		f := math.Mod(da, db)
-		v := NewDoubleValue(f)
-		s.Push(v)
-		return v, nil
+	if index < 0 || index >= len(s.values) {
+		return Value{}, fmt.Errorf("index %d out of range", index)
 	}
 
-	return Value{}, nil
+	return s.values[s.index(index)], nil
 }
 
-func (s *Stack) evalDiv() (Value, error) {
-	a, err := s.Pop()
-	if err != nil {
-		return Value{}, err
-	}
-
-	b, err := s.Pop()
+// Pick stacks a copy of the value at the index n, pick 0 being dup. An index
+// beyond the maximum depth of the stack is a StackOverflowError.
+func (s *Stack) Pick(n int) error {
+	v, err := s.Peek(n)
 	if err != nil {
-		return Value{}, err
-	}
-
-	switch GetBiggerType(a, b) {
-	case CharValue:
-		ca, err := a.ConvertToChar()
-		if err != nil {
-			return a, err
-		}
-
-		cb, err := b.ConvertToChar()
-		if err != nil {
-			return b, err
-		}
-
-		// if the divisor by 0 returns error
-		if cb == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-
-		v := NewInt8Value(ca / cb)
-		s.Push(v)
-		return v, nil
-	case ShortValue:
-		sa, err := a.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-		sb, err := b.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-
-		if sb == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-		v := NewInt16Value(int16(sa / sb))
-		s.Push(v)
-		return v, nil
-	case IntegerValue:
-		ia, err := a.ConvertToInteger()
-		if err != nil {
-			return a, err
-		}
-
-		ib, err := b.ConvertToInteger()
-		if err != nil {
-			return b, err
-		}
-
-		if b.V.(int32) == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-
-		v := NewInt32Value(ia / ib)
-		s.Push(v)
-		return v, nil
-	case FloatValue:
-		fa, err := a.ConvertToFloat()
-		if err != nil {
-			return a, err
-		}
-
-		fb, err := b.ConvertToFloat()
-		if err != nil {
-			return b, err
-		}
-
-		if b.V.(float32) == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
-		}
-
-		v := NewFloatValue(fa / fb)
-		s.Push(v)
-		return v, nil
-	case DoubleValue:
-		da, err := a.ConvertToDouble()
-		if err != nil {
-			return a, err
-		}
-
-		db, err := b.ConvertToDouble()
-		if err != nil {
-			return b, err
-		}
-
-		if b.V.(float64) == 0 || a.V.(float64) == 0 {
-			return Value{}, errors.New("error: integer divide by zero")
+		var overflow *StackOverflowError
+		if errors.As(err, &overflow) {
+			return err
 		}
-		v := NewDoubleValue(da / db)
-		s.Push(v)
-		return v, nil
+		return fmt.Errorf("error: pick %d out of range: got %d values on the stack", n, len(s.values))
 	}
 
-	return Value{}, nil
+	return s.Push(v)
 }
 
-func (s *Stack) evalMul() (Value, error) {
-
-	a, err := s.Pop()
-	if err != nil {
-		return Value{}, err
+// Roll moves the value at the index n to the top of the stack, roll 1 being
+// swap. Like for Pick, an index beyond the maximum depth of the stack is a
+// StackOverflowError.
+func (s *Stack) Roll(n int) error {
+	if s.max > 0 && n >= s.max {
+		return &StackOverflowError{MaxDepth: s.max}
 	}
 
-	b, err := s.Pop()
+	v, err := s.RemoveAt(n)
 	if err != nil {
-		return Value{}, err
+		return fmt.Errorf("error: roll %d out of range: got %d values on the stack", n, len(s.values))
 	}
 
-	switch GetBiggerType(a, b) {
-	case CharValue:
-		ca, err := a.ConvertToChar()
-		if err != nil {
-			return a, err
-		}
-
-		cb, err := b.ConvertToChar()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewInt8Value(ca * cb)
-		s.Push(v)
-		return v, nil
-	case ShortValue:
-		sa, err := a.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-		sb, err := b.ConvertToShort()
-		if err != nil {
-			return Value{}, err
-		}
-
-		v := NewInt16Value(sa * sb)
-		s.Push(v)
-		return v, nil
-	case IntegerValue:
-		ia, err := a.ConvertToInteger()
-		if err != nil {
-			return a, err
-		}
-
-		ib, err := b.ConvertToInteger()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewInt32Value(ia * ib)
-		s.Push(v)
-		return v, nil
-	case FloatValue:
-		fa, err := a.ConvertToFloat()
-		if err != nil {
-			return a, err
-		}
-
-		fb, err := b.ConvertToFloat()
-		if err != nil {
-			return b, err
-		}
-
-		v := NewFloatValue(fa + fb)
-		s.Push(v)
-		return v, nil
-	case DoubleValue:
-		da, err := a.ConvertToDouble()
-		if err != nil {
-			return a, err
-		}
-
-		db, err := b.ConvertToDouble()
-		if err != nil {
-			return b, err
-		}
+	return s.Push(v)
+}
 
-		v := NewDoubleValue(da * db)
-		s.Push(v)
-		return v, nil
+// Drop removes the first n values of the stack.
+func (s *Stack) Drop(n int) error {
+	if n < 0 || n > len(s.values) {
+		return fmt.Errorf("error: drop %d out of range: got %d values on the stack", n, len(s.values))
 	}
 
-	return Value{}, nil
+	s.truncate(len(s.values) - n)
+	return nil
 }
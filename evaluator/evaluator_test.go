@@ -2,9 +2,19 @@ package evaluator
 
 import (
 	"avm/parser"
+	"avm/token"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -22,7 +32,7 @@ func TestModOperand(t *testing.T) {
 		{"mod / short with result 0", "mod", NewInt16Value(5), NewInt8Value(2), NewInt16Value(2 % 5), false},
 		{"mod / short ", "mod", NewInt16Value(8), NewInt8Value(32), NewInt16Value(32 % 8), false},
 		{"mod / short divide by 0", "mod", NewInt16Value(8), NewInt8Value(0), NewInt16Value(0), false},
-		{"mod / float ", "mod", NewFloatValue(3), NewFloatValue(32.33), NewFloatValue(float32(math.Mod(32.33, 3))), false},
+		{"mod / float ", "mod", NewFloatValue(3), NewFloatValue(32.33), NewFloatValue(float32(math.Mod(float64(float32(32.33)), 3))), false},
 	}
 
 	for _, tt := range tests {
@@ -36,9 +46,9 @@ func TestModOperand(t *testing.T) {
 				return
 			}
 			require.NoError(t, err)
-			
-			require.Equal(t, tt.want.V, ev.V)
-			
+
+			require.Equal(t, tt.want, ev)
+
 		})
 
 	}
@@ -69,7 +79,7 @@ func TestDivOperand(t *testing.T) {
 				require.Error(t, err)
 				return
 			} else {
-				require.Equal(t, tt.want.V, ev.V)
+				require.Equal(t, tt.want, ev)
 			}
 		})
 
@@ -98,7 +108,774 @@ func TestMulOperand(t *testing.T) {
 			require.Error(t, err)
 			continue
 		} else {
-			require.Equal(t, tt.want.V, ev.V)
+			require.Equal(t, tt.want, ev)
+		}
+	}
+}
+
+func TestSubOperand(t *testing.T) {
+	tests := []struct {
+		a     Value
+		b     Value
+		want  Value
+		fails bool
+	}{
+		{NewInt8Value(2), NewInt8Value(5), NewInt8Value(3), false},
+		{NewInt8Value(2), NewInt16Value(5), NewInt16Value(3), false},
+		{NewInt32Value(10), NewInt16Value(4), NewInt32Value(-6), false},
+		{NewFloatValue(1.5), NewInt32Value(4), NewFloatValue(2.5), false},
+		{NewDoubleValue(1.25), NewFloatValue(4.5), NewDoubleValue(3.25), false},
+	}
+
+	for _, tt := range tests {
+		t.Run("sub evaluator", func(t *testing.T) {
+			st := NewStack()
+			st.Push(tt.a)
+			st.Push(tt.b)
+			ev, err := testEval(t, "sub", st)
+			if tt.fails {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			testIntegerObject(t, ev, tt.want)
+			require.Equal(t, 1, st.Size())
+		})
+	}
+
+	_, err := testEval(t, "sub", NewStack())
+	require.Error(t, err)
+}
+
+func TestEvalStackInstructions(t *testing.T) {
+	tests := []struct {
+		input string
+		stack []Value
+		want  []Value
+		fails bool
+	}{
+		{"clear", []Value{NewInt8Value(1), NewInt32Value(2)}, nil, false},
+		{"clear", nil, nil, false},
+		{"dup", []Value{NewInt8Value(1)}, []Value{NewInt8Value(1), NewInt8Value(1)}, false},
+		{"dup", nil, nil, true},
+		{"swap", []Value{NewInt8Value(1), NewInt32Value(2)}, []Value{NewInt8Value(1), NewInt32Value(2)}, false},
+		{"swap", []Value{NewInt8Value(1)}, nil, true},
+		{"print", []Value{NewInt8Value(42)}, []Value{NewInt8Value(42)}, false},
+		{"print", []Value{NewInt32Value(42)}, nil, true},
+		{"print", nil, nil, true},
+		{"over", []Value{NewInt8Value(1), NewInt32Value(2)}, []Value{NewInt8Value(1), NewInt32Value(2), NewInt8Value(1)}, false},
+		{"over", []Value{NewInt8Value(1)}, nil, true},
+		{"rot", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, []Value{NewInt8Value(1), NewInt32Value(3), NewInt16Value(2)}, false},
+		{"rot", []Value{NewInt8Value(1), NewInt16Value(2)}, nil, true},
+		{"pick 0", []Value{NewInt8Value(5)}, []Value{NewInt8Value(5), NewInt8Value(5)}, false},
+		{"pick 2", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, []Value{NewInt8Value(1), NewInt32Value(3), NewInt16Value(2), NewInt8Value(1)}, false},
+		{"pick 3", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, nil, true},
+		{"roll 0", []Value{NewInt8Value(1), NewInt16Value(2)}, []Value{NewInt16Value(2), NewInt8Value(1)}, false},
+		{"roll 1", []Value{NewInt8Value(1), NewInt16Value(2)}, []Value{NewInt8Value(1), NewInt16Value(2)}, false},
+		{"roll 2", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, []Value{NewInt8Value(1), NewInt32Value(3), NewInt16Value(2)}, false},
+		{"roll 3", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, nil, true},
+		{"drop 0", []Value{NewInt8Value(1)}, []Value{NewInt8Value(1)}, false},
+		{"drop 2", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, []Value{NewInt8Value(1)}, false},
+		{"drop 3", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, nil, false},
+		{"drop 4", []Value{NewInt8Value(1), NewInt16Value(2), NewInt32Value(3)}, nil, true},
+		{"depth", []Value{NewInt8Value(7), NewInt16Value(8)}, []Value{NewInt32Value(2), NewInt16Value(8), NewInt8Value(7)}, false},
+		{"depth", nil, []Value{NewInt32Value(0)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+" evaluator", func(t *testing.T) {
+			st := NewStack()
+			for _, v := range tt.stack {
+				st.Push(v)
+			}
+
+			_, err := testEval(t, tt.input, st)
+			if tt.fails {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, len(tt.want), st.Size())
+			for _, want := range tt.want {
+				v, err := st.Pop()
+				require.NoError(t, err)
+				testIntegerObject(t, v, want)
+			}
+		})
+	}
+
+	var stdout bytes.Buffer
+	vm := testVM(NewStack())
+	vm.Stdout = &stdout
+	_, err := testEvalVM(t, "push int8(72)\nprint\npop\npush int8(105)\nprint", vm)
+	require.NoError(t, err)
+	require.Equal(t, "Hi", stdout.String())
+}
+
+func TestEvalJumps(t *testing.T) {
+	countdown := `push int8(3)
+loop:
+	push int8(1)
+	swap
+	sub
+	dup
+	jnz loop
+`
+	tests := []struct {
+		input string
+		want  []Value
+	}{
+		{countdown, []Value{NewInt8Value(0)}},
+		{"push int32(1)\njmp end\npush int32(2)\nend:", []Value{NewInt32Value(1)}},
+		{"push int8(0)\njz zero\npush int8(1)\nzero: push int8(2)", []Value{NewInt8Value(2)}},
+		{"push int8(5)\njz zero\npush int8(1)\nzero: push int8(2)", []Value{NewInt8Value(2), NewInt8Value(1)}},
+		{"push double(-0.5)\njlt negative\npush int8(1)\nnegative:", []Value{}},
+		{"push float(0.5)\njlt negative\npush int8(1)\nnegative:", []Value{NewInt8Value(1)}},
+		{"push int16(2)\njgt pos\npush int8(1)\npos:", []Value{}},
+		{"push bigdecimal(-0.1)\njgt pos\npush int8(1)\npos:", []Value{NewInt8Value(1)}},
+	}
+
+	for _, tt := range tests {
+		st := NewStack()
+		_, err := testEval(t, tt.input, st)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, st.Values())
+	}
+}
+
+func TestEvalCall(t *testing.T) {
+	input := `push int32(3)
+call square
+push int32(4)
+call square
+add
+exit
+
+; squares the value at the top of the stack
+square:
+	dup
+	call times
+	ret
+times: mul
+	ret
+`
+	st := NewStack()
+	_, err := testEval(t, input, st)
+	require.Equal(t, ErrExit, err)
+	require.Equal(t, []Value{NewInt32Value(25)}, st.Values())
+
+	_, err = testEval(t, "push int8(1)\nret", NewStack())
+	require.True(t, errors.Is(err, ErrEmptyReturnStack))
+	require.EqualError(t, err, "2:1: ret: error: ret with an empty return stack (stack depth 1)")
+
+	_, err = testEval(t, "call nowhere", NewStack())
+	require.True(t, errors.Is(err, ErrUndefinedLabel))
+
+	p := parser.NewParser("f:\ncall f")
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+
+	vm := testVM(NewStack())
+	_, err = vm.Eval(pg)
+	require.True(t, errors.Is(err, ErrCallDepth))
+	require.EqualError(t, err, "2:1: call f: error: maximum call depth exceeded: 1024 (stack depth 0)")
+
+	vm.MaxCallDepth = 3
+	vm.MaxInstructions = 100
+	_, err = vm.Eval(pg)
+	require.True(t, errors.Is(err, ErrCallDepth))
+
+	vm.MaxCallDepth = 0
+	_, err = vm.Eval(pg)
+	require.True(t, errors.Is(err, ErrInstructionLimit))
+}
+
+func TestEvalVariables(t *testing.T) {
+	input := `push int16(10)
+store counter
+push bigdecimal(0.5)
+store half
+load counter
+load counter
+load half
+add
+`
+	vm := testVM(NewStack())
+	_, err := testEvalVM(t, input, vm)
+	require.NoError(t, err)
+	require.Equal(t, "[{10.5 bigdecimal} {10 int16}]", fmt.Sprint(vm.Stack.Values()))
+
+	// variables outlive the program and keep their type
+	_, err = testEvalVM(t, "load counter", vm)
+	require.NoError(t, err)
+	v, _ := vm.Stack.Peek(0)
+	require.Equal(t, NewInt16Value(10), v)
+
+	_, err = testEvalVM(t, "push int8(1)\n\n  load missing", vm)
+	require.True(t, errors.Is(err, ErrUndefinedVariable))
+	require.EqualError(t, err, `3:3: load missing: error: undefined variable "missing" (stack depth 4)`)
+
+	vm.Reset()
+	require.Equal(t, 0, vm.Stack.Size())
+	_, err = testEvalVM(t, "load counter", vm)
+	require.True(t, errors.Is(err, ErrUndefinedVariable))
+
+	_, err = testEvalVM(t, "store x", vm)
+	require.EqualError(t, err, "1:1: store x: error: store on empty stack (stack depth 0)")
+}
+
+func TestEvalCompare(t *testing.T) {
+	tests := []struct {
+		input string
+		a     Value // value at the top of the stack
+		b     Value
+		want  int8
+	}{
+		{"eq", NewInt8Value(2), NewInt8Value(2), 1},
+		{"eq", NewInt8Value(2), NewInt32Value(2), 1},
+		{"eq", NewFloatValue(0.5), NewBigDecimalValue(big.NewRat(1, 2)), 1},
+		{"eq", NewInt16Value(1), NewDoubleValue(1.5), 0},
+		{"neq", NewInt16Value(1), NewDoubleValue(1.5), 1},
+		{"neq", NewInt32Value(7), NewInt8Value(7), 0},
+		{"lt", NewInt8Value(1), NewInt8Value(2), 1},
+		{"lt", NewInt8Value(2), NewInt8Value(1), 0},
+		{"lt", NewInt8Value(2), NewInt8Value(2), 0},
+		{"le", NewInt8Value(2), NewInt8Value(2), 1},
+		{"le", NewDoubleValue(-0.25), NewInt32Value(-1), 0},
+		{"gt", NewDoubleValue(-0.25), NewInt32Value(-1), 1},
+		{"gt", NewBigDecimalValue(big.NewRat(1, 3)), NewDoubleValue(0.4), 0},
+		{"ge", NewBigDecimalValue(big.NewRat(1, 3)), NewBigDecimalValue(big.NewRat(1, 3)), 1},
+		{"ge", NewInt32Value(-2147483648), NewInt32Value(2147483647), 0},
+		{"eq", NewDoubleValue(math.NaN()), NewDoubleValue(math.NaN()), 0},
+		{"le", NewDoubleValue(math.NaN()), NewInt8Value(1), 0},
+		{"neq", NewFloatValue(float32(math.NaN())), NewInt8Value(1), 1},
+	}
+
+	for _, tt := range tests {
+		st := NewStack()
+		st.Push(tt.b)
+		st.Push(tt.a)
+		v, err := testEval(t, tt.input, st)
+		require.NoError(t, err)
+		require.Equal(t, NewInt8Value(tt.want), v, "%s %s %s", tt.a, tt.input, tt.b)
+		require.Equal(t, []Value{NewInt8Value(tt.want)}, st.Values())
+	}
+
+	st := NewStack()
+	st.Push(NewInt8Value(1))
+	_, err := testEval(t, "lt", st)
+	require.EqualError(t, err, "1:1: lt: error: lt requires at least 2 values on the stack: got 1 (stack depth 1)")
+
+	// the result drives conditional jumps
+	st = NewStack()
+	_, err = testEval(t, "push int8(3)\npush int32(4)\nlt\njz end\npush int8(42)\nend:", st)
+	require.NoError(t, err)
+	require.Equal(t, []Value{}, st.Values())
+}
+
+func TestEvalMath(t *testing.T) {
+	tests := []struct {
+		input string
+		stack []Value // from the bottom to the top of the stack
+		want  Value
+	}{
+		{"neg", []Value{NewInt8Value(5)}, NewInt8Value(-5)},
+		{"neg", []Value{NewInt32Value(-7)}, NewInt32Value(7)},
+		{"neg", []Value{NewDoubleValue(1.5)}, NewDoubleValue(-1.5)},
+		{"neg", []Value{NewBigDecimalValue(big.NewRat(1, 3))}, NewBigDecimalValue(big.NewRat(-1, 3))},
+		{"abs", []Value{NewInt16Value(-300)}, NewInt16Value(300)},
+		{"abs", []Value{NewInt8Value(4)}, NewInt8Value(4)},
+		{"abs", []Value{NewFloatValue(-2.5)}, NewFloatValue(2.5)},
+		{"abs", []Value{NewBigDecimalValue(big.NewRat(-1, 10))}, NewBigDecimalValue(big.NewRat(1, 10))},
+		{"min", []Value{NewInt8Value(3), NewInt32Value(-4)}, NewInt32Value(-4)},
+		{"min", []Value{NewDoubleValue(0.5), NewFloatValue(1)}, NewDoubleValue(0.5)},
+		{"max", []Value{NewInt8Value(3), NewInt32Value(-4)}, NewInt32Value(3)},
+		{"max", []Value{NewBigDecimalValue(big.NewRat(1, 3)), NewDoubleValue(0.25)}, NewBigDecimalValue(big.NewRat(1, 3))},
+		{"pow", []Value{NewInt8Value(10), NewInt32Value(2)}, NewInt32Value(1024)},
+		{"pow", []Value{NewInt32Value(3), NewInt8Value(-5)}, NewInt8Value(-125)},
+		{"pow", []Value{NewInt8Value(0), NewInt16Value(9)}, NewInt16Value(1)},
+		{"pow", []Value{NewInt32Value(100), NewInt8Value(1)}, NewInt8Value(1)},
+		{"pow", []Value{NewInt8Value(-2), NewDoubleValue(2)}, NewDoubleValue(0.25)},
+		{"pow", []Value{NewInt8Value(3), NewFloatValue(0.5)}, NewFloatValue(0.125)},
+		{"pow", []Value{NewInt8Value(-2), NewBigDecimalValue(big.NewRat(2, 3))}, NewBigDecimalValue(big.NewRat(9, 4))},
+		{"sqrt", []Value{NewDoubleValue(2.25)}, NewDoubleValue(1.5)},
+		{"sqrt", []Value{NewFloatValue(16)}, NewFloatValue(4)},
+		{"exp", []Value{NewDoubleValue(0)}, NewDoubleValue(1)},
+		{"log", []Value{NewDoubleValue(math.E)}, NewDoubleValue(1)},
+		{"sin", []Value{NewDoubleValue(0)}, NewDoubleValue(0)},
+		{"cos", []Value{NewFloatValue(0)}, NewFloatValue(1)},
+	}
+
+	for _, tt := range tests {
+		st := NewStack()
+		for _, v := range tt.stack {
+			st.Push(v)
+		}
+		v, err := testEval(t, tt.input, st)
+		require.NoError(t, err, "%s %v", tt.input, tt.stack)
+		require.Equal(t, tt.want.String(), v.String(), "%s %v", tt.input, tt.stack)
+		require.Equal(t, tt.want.Type, v.Type)
+		require.Equal(t, 1, st.Size())
+	}
+
+	errs := []struct {
+		input string
+		stack []Value
+		msg   string
+	}{
+		{"neg", []Value{NewInt8Value(-128)}, "1:1: neg: error: int8 overflow on neg (stack depth 1)"},
+		{"abs", []Value{NewInt32Value(math.MinInt32)}, "1:1: abs: error: int32 overflow on abs (stack depth 1)"},
+		{"pow", []Value{NewInt8Value(8), NewInt8Value(2)}, "1:1: pow: error: int8 overflow on pow (stack depth 2)"},
+		{"pow", []Value{NewInt8Value(127), NewInt32Value(-3)}, "1:1: pow: error: int32 underflow on pow (stack depth 2)"},
+		{"pow", []Value{NewInt8Value(-1), NewInt32Value(2)}, "1:1: pow: error: negative exponent on an integer (stack depth 2)"},
+		{"pow", []Value{NewFloatValue(2), NewInt32Value(2)}, "1:1: pow: error: pow requires an integer exponent: got float (stack depth 2)"},
+		{"pow", []Value{NewInt8Value(-1), NewDoubleValue(0)}, "1:1: pow: error: division by zero (stack depth 2)"},
+		{"sqrt", []Value{NewDoubleValue(-1)}, "1:1: sqrt: error: domain error: sqrt of a negative value (stack depth 1)"},
+		{"log", []Value{NewFloatValue(0)}, "1:1: log: error: domain error: log of a value lower or equal to zero (stack depth 1)"},
+		{"cos", []Value{NewDoubleValue(math.Inf(1))}, "1:1: cos: error: domain error: cos of an infinite value (stack depth 1)"},
+		{"exp", []Value{NewFloatValue(100)}, "1:1: exp: error: float overflow on exp (stack depth 1)"},
+		{"sqrt", []Value{NewInt32Value(4)}, "1:1: sqrt: error: sqrt requires float or double operands: got int32 (stack depth 1)"},
+		{"min", []Value{NewInt8Value(1)}, "1:1: min: error: min requires at least 2 values on the stack: got 1 (stack depth 1)"},
+		{"abs", nil, "1:1: abs: error: abs on empty stack (stack depth 0)"},
+	}
+
+	for _, tt := range errs {
+		st := NewStack()
+		for _, v := range tt.stack {
+			st.Push(v)
+		}
+		_, err := testEval(t, tt.input, st)
+		require.EqualError(t, err, tt.msg)
+		require.Equal(t, strings.Contains(tt.msg, "domain error"), errors.Is(err, ErrDomain))
+	}
+
+	// wrapping and saturating modes apply to integer results
+	for _, tt := range []struct {
+		mode  ArithmeticMode
+		input string
+		want  Value
+	}{
+		{WrappingArithmetic, "push int8(7)\npush int8(2)\npow", NewInt8Value(-128)},
+		{WrappingArithmetic, "push int8(3)\npush int8(-3)\npow", NewInt8Value(-27)},
+		{WrappingArithmetic, "push int32(100)\npush int32(3)\npow", NewInt32Value(-818408495)},
+		{WrappingArithmetic, "push int8(-128)\nneg", NewInt8Value(-128)},
+		{SaturatingArithmetic, "push int32(101)\npush int16(-3)\npow", NewInt16Value(math.MinInt16)},
+		{SaturatingArithmetic, "push int32(100)\npush int16(-3)\npow", NewInt16Value(math.MaxInt16)},
+		{SaturatingArithmetic, "push int16(-32768)\nabs", NewInt16Value(math.MaxInt16)},
+	} {
+		vm := testVM(NewStack())
+		vm.Mode = tt.mode
+		v, err := testEvalVM(t, tt.input, vm)
+		require.NoError(t, err, tt.input)
+		require.Equal(t, tt.want, v, tt.input)
+	}
+}
+
+func TestEvalCast(t *testing.T) {
+	tests := []struct {
+		input string
+		value Value
+		want  Value
+	}{
+		{"cast int8", NewInt32Value(100), NewInt8Value(100)},
+		{"cast int8", NewInt16Value(-128), NewInt8Value(-128)},
+		{"cast int16", NewInt8Value(-5), NewInt16Value(-5)},
+		{"cast int32", NewInt32Value(7), NewInt32Value(7)},
+		{"cast int32", NewDoubleValue(2.9), NewInt32Value(2)},
+		{"cast int32", NewDoubleValue(-2.9), NewInt32Value(-2)},
+		{"cast int8", NewFloatValue(127.99), NewInt8Value(127)},
+		{"cast int16", NewBigDecimalValue(big.NewRat(-7, 2)), NewInt16Value(-3)},
+		{"cast float", NewInt32Value(16777217), NewFloatValue(16777216)},
+		{"cast float", NewDoubleValue(0.1), NewFloatValue(0.1)},
+		{"cast float", NewBigDecimalValue(big.NewRat(1, 4)), NewFloatValue(0.25)},
+		{"cast double", NewBigDecimalValue(big.NewRat(1, 3)), NewDoubleValue(1.0 / 3)},
+		{"cast double", NewInt16Value(3), NewDoubleValue(3)},
+		{"cast bigdecimal", NewFloatValue(0.1), NewBigDecimalValue(big.NewRat(1, 10))},
+	}
+
+	for _, tt := range tests {
+		st := NewStack()
+		st.Push(tt.value)
+		v, err := testEval(t, tt.input, st)
+		require.NoError(t, err, "%s %s", tt.input, tt.value)
+		require.Equal(t, tt.want.String(), v.String(), "%s %s", tt.input, tt.value)
+		require.Equal(t, []Value{v}, st.Values())
+	}
+
+	errs := []struct {
+		input string
+		value Value
+		msg   string
+	}{
+		{"cast int8", NewInt32Value(300), "1:1: cast int8: error: int8 overflow on cast (stack depth 1)"},
+		{"cast int16", NewInt32Value(-40000), "1:1: cast int16: error: int16 underflow on cast (stack depth 1)"},
+		{"cast int8", NewDoubleValue(128), "1:1: cast int8: error: int8 overflow on cast (stack depth 1)"},
+		{"cast int32", NewDoubleValue(math.Inf(-1)), "1:1: cast int32: error: int32 underflow on cast (stack depth 1)"},
+		{"cast int32", NewDoubleValue(1e300), "1:1: cast int32: error: int32 overflow on cast (stack depth 1)"},
+		{"cast int32", NewFloatValue(float32(math.NaN())), "1:1: cast int32: error: cannot cast NaN to int32 (stack depth 1)"},
+		{"cast int32", NewBigDecimalValue(new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 70))), "1:1: cast int32: error: int32 overflow on cast (stack depth 1)"},
+		{"cast float", NewDoubleValue(-1e300), "1:1: cast float: error: float underflow on cast (stack depth 1)"},
+		{"cast double", NewBigDecimalValue(new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(400), nil))), "1:1: cast double: error: double overflow on cast (stack depth 1)"},
+		{"cast bigdecimal", NewDoubleValue(math.Inf(1)), "1:1: cast bigdecimal: error: cannot cast +Inf to bigdecimal (stack depth 1)"},
+	}
+
+	for _, tt := range errs {
+		st := NewStack()
+		st.Push(tt.value)
+		_, err := testEval(t, tt.input, st)
+		require.EqualError(t, err, tt.msg)
+		// compared as text since NaN is not equal to itself
+		require.Equal(t, fmt.Sprint([]Value{tt.value}), fmt.Sprint(st.Values()))
+	}
+
+	_, err := testEval(t, "cast int8", NewStack())
+	require.EqualError(t, err, "1:1: cast int8: error: cast on empty stack (stack depth 0)")
+}
+
+func TestEvalBitwise(t *testing.T) {
+	tests := []struct {
+		input string
+		a     Value // value at the top of the stack
+		b     Value
+		want  Value
+	}{
+		{"and", NewInt8Value(12), NewInt8Value(10), NewInt8Value(8)},
+		{"or", NewInt8Value(12), NewInt8Value(10), NewInt8Value(14)},
+		{"xor", NewInt8Value(12), NewInt8Value(10), NewInt8Value(6)},
+		{"and", NewInt8Value(-1), NewInt32Value(65535), NewInt32Value(65535)},
+		{"or", NewInt16Value(256), NewInt8Value(1), NewInt16Value(257)},
+		{"shl", NewInt8Value(1), NewInt8Value(3), NewInt8Value(8)},
+		{"shl", NewInt8Value(64), NewInt8Value(1), NewInt8Value(-128)},
+		{"shl", NewInt8Value(1), NewInt8Value(8), NewInt8Value(0)},
+		{"shl", NewInt16Value(1), NewInt8Value(8), NewInt16Value(256)},
+		{"shr", NewInt8Value(-128), NewInt8Value(7), NewInt8Value(1)},
+		{"shr", NewInt32Value(-1), NewInt32Value(28), NewInt32Value(15)},
+		{"shr", NewInt16Value(16), NewInt16Value(40), NewInt16Value(0)},
+		{"sar", NewInt8Value(-128), NewInt8Value(7), NewInt8Value(-1)},
+		{"sar", NewInt32Value(-16), NewInt32Value(2), NewInt32Value(-4)},
+		{"sar", NewInt16Value(-5), NewInt16Value(100), NewInt16Value(-1)},
+		{"sar", NewInt16Value(20), NewInt8Value(2), NewInt16Value(5)},
+	}
+
+	for _, tt := range tests {
+		st := NewStack()
+		st.Push(tt.b)
+		st.Push(tt.a)
+		v, err := testEval(t, tt.input, st)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, v, "%s %s %s", tt.a, tt.input, tt.b)
+		require.Equal(t, []Value{tt.want}, st.Values())
+	}
+
+	for _, tt := range []struct{ a, want Value }{
+		{NewInt8Value(0), NewInt8Value(-1)},
+		{NewInt16Value(255), NewInt16Value(-256)},
+		{NewInt32Value(-2147483648), NewInt32Value(2147483647)},
+	} {
+		st := NewStack()
+		st.Push(tt.a)
+		v, err := testEval(t, "not", st)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, v, "not %s", tt.a)
+	}
+
+	errs := []struct {
+		input string
+		stack []Value
+		msg   string
+	}{
+		{"and", []Value{NewInt8Value(1), NewFloatValue(1)}, "1:1: and: error: and requires integer operands: got float (stack depth 2)"},
+		{"or", []Value{NewDoubleValue(1), NewInt32Value(1)}, "1:1: or: error: or requires integer operands: got double (stack depth 2)"},
+		{"not", []Value{NewBigDecimalValue(big.NewRat(1, 1))}, "1:1: not: error: not requires integer operands: got bigdecimal (stack depth 1)"},
+		{"shl", []Value{NewInt8Value(-1), NewInt8Value(1)}, "1:1: shl: error: negative shift count (stack depth 2)"},
+		{"xor", []Value{NewInt8Value(1)}, "1:1: xor: error: xor requires at least 2 values on the stack: got 1 (stack depth 1)"},
+		{"not", nil, "1:1: not: error: not on empty stack (stack depth 0)"},
+	}
+
+	for _, tt := range errs {
+		st := NewStack()
+		for _, v := range tt.stack {
+			st.Push(v)
+		}
+		_, err := testEval(t, tt.input, st)
+		require.EqualError(t, err, tt.msg)
+
+		var typeErr *TypeError
+		require.Equal(t, strings.Contains(tt.msg, "integer operands"), errors.As(err, &typeErr))
+	}
+}
+
+func TestEvalJumpErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+		msg   string
+	}{
+		{"push int8(1)\njmp nowhere", ErrUndefinedLabel, `2:1: error: undefined label "nowhere"`},
+		{"a:\npush int8(1)\na:", ErrDuplicateLabel, `3:1: error: duplicate label "a"`},
+		{"a:\njz a", nil, "2:1: jz a: error: jz on empty stack (stack depth 0)"},
+	}
+
+	for _, tt := range tests {
+		st := NewStack()
+		_, err := testEval(t, tt.input, st)
+		require.EqualError(t, err, tt.msg)
+		if tt.err != nil {
+			require.True(t, errors.Is(err, tt.err))
+			require.Equal(t, 0, st.Size())
+		}
+	}
+
+	p := parser.NewParser("loop:\njmp loop")
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+
+	vm := testVM(NewStack())
+	vm.MaxInstructions = 100
+	_, err = vm.Eval(pg)
+	hErr, ok := err.(*HaltError)
+	require.True(t, ok)
+	require.Equal(t, 100, hErr.Executed)
+}
+
+func TestVMOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	vm := NewVM(NewStack())
+	vm.Stdout = &stdout
+	vm.Stderr = &stderr
+
+	p := parser.NewParser("push int8(72)\nprint\npush int32(42)\ndump")
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+	_, err = vm.Eval(pg)
+	require.NoError(t, err)
+	require.Equal(t, "H{42 int32}\n{72 int8}\n\n", stdout.String())
+	require.Empty(t, stderr.String())
+
+	stdout.Reset()
+	vm.Debug = true
+	_, err = vm.Eval(pg)
+	require.NoError(t, err)
+	require.Contains(t, stdout.String(), "H{42 int32}")
+	require.Equal(t, "debug: 1:1: push int8(72) (stack depth 2)\n", strings.SplitAfter(stderr.String(), "\n")[0])
+	require.Len(t, strings.Split(strings.TrimSpace(stderr.String()), "\n"), 4)
+}
+
+func TestEvalExit(t *testing.T) {
+	st := NewStack()
+	_, err := testEval(t, "exit", st)
+	require.Equal(t, ErrExit, err)
+}
+
+func TestBigDecimalOperand(t *testing.T) {
+	tests := []struct {
+		input string
+		a     Value
+		b     Value
+		want  string
+		fails bool
+	}{
+		{"add", NewBigDecimalValue(big.NewRat(1, 10)), NewBigDecimalValue(big.NewRat(2, 10)), "0.3", false},
+		{"add", NewDoubleValue(0.1), NewBigDecimalValue(big.NewRat(2, 10)), "0.3", false},
+		{"sub", NewBigDecimalValue(big.NewRat(1, 10)), NewBigDecimalValue(big.NewRat(3, 10)), "0.2", false},
+		{"mul", NewBigDecimalValue(big.NewRat(11, 10)), NewBigDecimalValue(big.NewRat(11, 10)), "1.21", false},
+		{"div", NewInt8Value(4), NewBigDecimalValue(big.NewRat(1, 1)), "0.25", false},
+		{"div", NewInt8Value(3), NewBigDecimalValue(big.NewRat(1, 1)), "0.3333333333333333333333333333333333", false},
+		{"div", NewBigDecimalValue(new(big.Rat)), NewInt8Value(1), "", true},
+		{"mod", NewBigDecimalValue(big.NewRat(3, 10)), NewBigDecimalValue(big.NewRat(10, 1)), "0.1", false},
+		{"mod", NewInt8Value(3), NewBigDecimalValue(big.NewRat(-10, 1)), "-1", false},
+		{"mod", NewBigDecimalValue(new(big.Rat)), NewInt8Value(1), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+" bigdecimal", func(t *testing.T) {
+			st := NewStack()
+			st.Push(tt.a)
+			st.Push(tt.b)
+			ev, err := testEval(t, tt.input, st)
+			if tt.fails {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, BigDecimalValue, ev.Type)
+			require.Equal(t, "{"+tt.want+" bigdecimal}", ev.String())
+		})
+	}
+}
+
+func TestBigDecimalInstructions(t *testing.T) {
+	st := NewStack()
+	for _, in := range []string{"push bigdecimal(0.1)", "push bigdecimal(0.2)", "add"} {
+		_, err := testEval(t, in, st)
+		require.NoError(t, err)
+	}
+
+	_, err := testEval(t, "assert bigdecimal(0.30)", st)
+	require.NoError(t, err)
+	_, err = testEval(t, "assert bigdecimal(0.31)", st)
+	require.Error(t, err)
+	_, err = testEval(t, "assert double(0.3)", st)
+	require.Error(t, err)
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input     string
+		a         Value
+		b         Value
+		overflow  bool
+		underflow bool
+	}{
+		{"add", NewInt8Value(1), NewInt8Value(127), true, false},
+		{"add", NewInt8Value(-1), NewInt8Value(-128), false, true},
+		{"add", NewInt8Value(1), NewInt8Value(126), false, false},
+		{"sub", NewInt8Value(1), NewInt8Value(-128), false, true},
+		{"sub", NewInt16Value(-1), NewInt16Value(math.MaxInt16), true, false},
+		{"mul", NewInt16Value(2), NewInt16Value(math.MaxInt16), true, false},
+		{"mul", NewInt32Value(2), NewInt32Value(math.MinInt32), false, true},
+		{"div", NewInt8Value(-1), NewInt8Value(-128), true, false},
+		{"div", NewInt32Value(-1), NewInt32Value(math.MinInt32), true, false},
+		{"mod", NewInt8Value(-1), NewInt8Value(-128), false, false},
+		{"add", NewFloatValue(math.MaxFloat32), NewFloatValue(math.MaxFloat32), true, false},
+		{"mul", NewDoubleValue(-2), NewDoubleValue(math.MaxFloat64), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+" overflow", func(t *testing.T) {
+			st := NewStack()
+			st.Push(tt.a)
+			st.Push(tt.b)
+			_, err := testEval(t, tt.input, st)
+			switch {
+			case tt.overflow:
+				require.IsType(t, &OverflowError{}, errors.Unwrap(err))
+			case tt.underflow:
+				require.IsType(t, &UnderflowError{}, errors.Unwrap(err))
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestArithmeticMode(t *testing.T) {
+	tests := []struct {
+		mode  ArithmeticMode
+		input string
+		a     Value
+		b     Value
+		want  Value
+	}{
+		{WrappingArithmetic, "add", NewInt8Value(1), NewInt8Value(127), NewInt8Value(-128)},
+		{WrappingArithmetic, "sub", NewInt16Value(1), NewInt16Value(math.MinInt16), NewInt16Value(math.MaxInt16)},
+		{WrappingArithmetic, "div", NewInt32Value(-1), NewInt32Value(math.MinInt32), NewInt32Value(math.MinInt32)},
+		{SaturatingArithmetic, "add", NewInt8Value(1), NewInt8Value(127), NewInt8Value(127)},
+		{SaturatingArithmetic, "sub", NewInt16Value(1), NewInt16Value(math.MinInt16), NewInt16Value(math.MinInt16)},
+		{SaturatingArithmetic, "mul", NewInt32Value(2), NewInt32Value(math.MaxInt32), NewInt32Value(math.MaxInt32)},
+		{SaturatingArithmetic, "mul", NewFloatValue(-2), NewFloatValue(math.MaxFloat32), NewFloatValue(-math.MaxFloat32)},
+		{WrappingArithmetic, "mul", NewFloatValue(2), NewFloatValue(math.MaxFloat32), NewFloatValue(float32(math.Inf(1)))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String()+" "+tt.input, func(t *testing.T) {
+			vm := testVM(NewStack())
+			vm.Mode = tt.mode
+			vm.Stack.Push(tt.a)
+			vm.Stack.Push(tt.b)
+			v, err := testEvalVM(t, tt.input, vm)
+			require.NoError(t, err)
+			testIntegerObject(t, v, tt.want)
+		})
+	}
+}
+
+func TestEvalNegativeLiterals(t *testing.T) {
+	st := NewStack()
+	for _, in := range []string{"push int8(-128)", "push int8(-1)", "add"} {
+		_, err := testEval(t, in, st)
+		if in == "add" {
+			require.IsType(t, &UnderflowError{}, errors.Unwrap(err))
+			continue
+		}
+		require.NoError(t, err)
+	}
+
+	_, err := testEval(t, "push int32(2147483647 + 1)", NewStack())
+	require.IsType(t, &OverflowError{}, errors.Unwrap(err))
+}
+
+func TestFailingInstructionKeepsStack(t *testing.T) {
+	tests := []struct {
+		input string
+		stack []Value
+	}{
+		{"add", []Value{NewInt8Value(1), NewInt8Value(127)}},
+		{"sub", []Value{NewInt16Value(math.MinInt16), NewInt16Value(1)}},
+		{"mul", []Value{NewDoubleValue(math.MaxFloat64), NewDoubleValue(2)}},
+		{"div", []Value{NewInt32Value(0), NewInt32Value(1)}},
+		{"mod", []Value{NewBigDecimalValue(new(big.Rat)), NewBigDecimalValue(big.NewRat(1, 2))}},
+		{"lt", []Value{NewBigDecimalValue(big.NewRat(1, 2)), NewDoubleValue(math.Inf(1))}},
+		{"not", []Value{NewFloatValue(1)}},
+		{"and", []Value{NewInt8Value(1), NewDoubleValue(1)}},
+		{"shl", []Value{NewInt32Value(-1), NewInt32Value(1)}},
+		{"neg", []Value{NewInt8Value(-128)}},
+		{"sqrt", []Value{NewDoubleValue(-1)}},
+		{"log", []Value{NewInt32Value(1)}},
+		{"max", []Value{NewBigDecimalValue(big.NewRat(1, 2)), NewFloatValue(float32(math.Inf(1)))}},
+		{"pow", []Value{NewInt8Value(2), NewInt8Value(100)}},
+		{"pow", []Value{NewDoubleValue(2), NewInt8Value(2)}},
+		{"cast int8", []Value{NewInt32Value(300)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			st := NewStack()
+			for _, v := range tt.stack {
+				st.Push(v)
+			}
+
+			want := st.Values()
+			_, err := testEval(t, tt.input, st)
+			require.Error(t, err)
+			require.Equal(t, want, st.Values())
+		})
+	}
+}
+
+func TestTypePromotion(t *testing.T) {
+	ops := []string{"add", "sub", "mul", "div", "mod"}
+	values := []Value{
+		NewInt8Value(2),
+		NewInt16Value(2),
+		NewInt32Value(2),
+		NewFloatValue(2),
+		NewDoubleValue(2),
+		NewBigDecimalValue(big.NewRat(2, 1)),
+	}
+
+	// every pair of types gives a result of the wider type, whatever the
+	// instruction and the order of the operands.
+	for _, op := range ops {
+		for i, a := range values {
+			for j, b := range values {
+				t.Run(fmt.Sprintf("%s %s %s", op, a.Type, b.Type), func(t *testing.T) {
+					st := NewStack()
+					st.Push(b)
+					st.Push(a)
+					v, err := testEval(t, op, st)
+					require.NoError(t, err)
+
+					want := values[i].Type
+					if j > i {
+						want = values[j].Type
+					}
+					require.Equal(t, want, v.Type)
+				})
+			}
 		}
 	}
 }
@@ -111,10 +888,10 @@ func TestStackSwap(t *testing.T) {
 	require.NoError(t, err)
 	a, err := s.Pop()
 	require.NoError(t, err)
-	require.Equal(t, NewInt32Value(10).V, a.V)
+	require.Equal(t, NewInt32Value(10), a)
 	b, err := s.Pop()
 	require.NoError(t, err)
-	require.Equal(t, NewInt32Value(14).V, b.V)
+	require.Equal(t, NewInt32Value(14), b)
 }
 
 func TestStackDup(t *testing.T) {
@@ -125,7 +902,108 @@ func TestStackDup(t *testing.T) {
 	require.NoError(t, err)
 	b, err := s.Pop()
 	require.NoError(t, err)
-	require.Equal(t, a.V, b.V)
+	require.Equal(t, a, b)
+}
+
+func TestStackIndexes(t *testing.T) {
+	s := NewStack()
+	require.NoError(t, s.InsertAt(0, NewInt32Value(1)))
+	for i := 2; i <= 20; i++ {
+		s.Push(NewInt32Value(int32(i)))
+	}
+
+	// the stack is 20 19 ... 2 1 from the top
+	v, err := s.Peek(19)
+	require.NoError(t, err)
+	require.Equal(t, NewInt32Value(1), v)
+	_, err = s.Peek(20)
+	require.EqualError(t, err, "index 20 out of range")
+
+	require.NoError(t, s.InsertAt(20, NewInt8Value(0)))
+	require.NoError(t, s.InsertAt(1, NewInt8Value(-1)))
+	require.Equal(t, 22, s.Size())
+	require.Equal(t, NewInt8Value(0), s.Values()[21])
+	require.Equal(t, NewInt8Value(-1), s.Values()[1])
+	require.Error(t, s.InsertAt(23, NewInt8Value(0)))
+
+	v, err = s.RemoveAt(21)
+	require.NoError(t, err)
+	require.Equal(t, NewInt8Value(0), v)
+	v, err = s.RemoveAt(1)
+	require.NoError(t, err)
+	require.Equal(t, NewInt8Value(-1), v)
+	v, err = s.RemoveAt(0)
+	require.NoError(t, err)
+	require.Equal(t, NewInt32Value(20), v)
+	require.Equal(t, 19, s.Size())
+	_, err = s.RemoveAt(19)
+	require.Error(t, err)
+
+	require.NoError(t, s.Roll(18))
+	require.NoError(t, s.Pick(18))
+	require.Equal(t, []Value{NewInt32Value(2), NewInt32Value(1), NewInt32Value(19)}, s.Values()[:3])
+	require.EqualError(t, s.Drop(21), "error: drop 21 out of range: got 20 values on the stack")
+	require.NoError(t, s.Drop(20))
+	require.True(t, s.IsEmpty())
+}
+
+func TestStackMaxDepth(t *testing.T) {
+	s := NewStack()
+	require.Equal(t, DefaultMaxDepth, s.MaxDepth())
+
+	s.SetMaxDepth(3)
+	require.NoError(t, s.Push(NewInt8Value(1)))
+	require.NoError(t, s.InsertAt(1, NewInt8Value(0)))
+	require.NoError(t, s.Dup())
+
+	var overflow *StackOverflowError
+	err := s.Push(NewInt8Value(2))
+	require.True(t, errors.As(err, &overflow))
+	require.Equal(t, 3, overflow.MaxDepth)
+	require.EqualError(t, err, "error: stack overflow: the maximum depth of 3 values is reached")
+	require.True(t, errors.As(s.InsertAt(0, NewInt8Value(2)), &overflow))
+	require.True(t, errors.As(s.Dup(), &overflow))
+	require.Error(t, s.Pick(0))
+	_, err = s.Peek(3)
+	require.True(t, errors.As(err, &overflow))
+	require.Equal(t, 3, s.Size())
+
+	// through the instructions, as for any other overflow
+	vm := testVM(s)
+	for _, in := range []string{"pick 2147483647", "roll 2147483647", "pick 3", "roll 3"} {
+		_, err = testEvalVM(t, in, vm)
+		require.True(t, errors.As(err, &overflow), in)
+	}
+	_, err = testEvalVM(t, "pick 2", testVM(NewStack()))
+	require.False(t, errors.As(err, &overflow))
+	require.Contains(t, err.Error(), "error: pick 2 out of range: got 0 values on the stack")
+	require.Equal(t, 3, s.Size())
+
+	// roll and swap move values without growing the stack
+	require.NoError(t, s.Roll(2))
+	require.NoError(t, s.Swap())
+
+	_, _ = s.Pop()
+	require.NoError(t, s.Push(NewInt8Value(2)))
+
+	s.SetMaxDepth(0)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, s.Push(NewInt8Value(int8(i))))
+	}
+
+	_, err = s.Peek(50)
+	require.NoError(t, err)
+
+	st := NewStack()
+	st.SetMaxDepth(2)
+	_, err = testEval(t, "push int8(1)\ndup\ndup", st)
+	require.True(t, errors.As(err, &overflow))
+	require.EqualError(t, err, "3:1: dup: error: stack overflow: the maximum depth of 2 values is reached (stack depth 2)")
+
+	st = NewStack()
+	st.SetMaxDepth(2)
+	_, err = testEval(t, "push int8(1)\npush int8(2)\ndepth", st)
+	require.True(t, errors.As(err, &overflow))
 }
 
 func TestStackClear(t *testing.T) {
@@ -135,7 +1013,7 @@ func TestStackClear(t *testing.T) {
 	}
 
 	s.Clear()
-	require.Equal(t, 0, s.size)
+	require.Equal(t, 0, s.Size())
 }
 
 func TestConvertAstToValue(t *testing.T) {
@@ -159,10 +1037,13 @@ func TestConvertAstToValue(t *testing.T) {
 		}
 
 		require.NoError(t, err)
-		require.Equal(t, fmt.Sprintf("%.2f", tt.want.V), fmt.Sprintf("%.2f", v.V))
+		require.Equal(t, tt.want.Type, v.Type)
+		want, _ := tt.want.ConvertToDouble()
+		got, _ := v.ConvertToDouble()
+		require.Equal(t, fmt.Sprintf("%.2f", want), fmt.Sprintf("%.2f", got))
 	}
 
-	st.Dump()
+	require.NoError(t, st.Dump(ioutil.Discard))
 }
 
 func TestEvalAddInstruction(t *testing.T) {
@@ -185,11 +1066,14 @@ func TestEvalAddInstruction(t *testing.T) {
 		st.Push(tt.b)
 		v, err := testEval(t, tt.input, st)
 		require.NoError(t, err)
-		require.Equal(t, fmt.Sprintf("%.2f", tt.want.V), fmt.Sprintf("%.2f", v.V))
+		require.Equal(t, tt.want.Type, v.Type)
+		want, _ := tt.want.ConvertToDouble()
+		got, _ := v.ConvertToDouble()
+		require.Equal(t, fmt.Sprintf("%.2f", want), fmt.Sprintf("%.2f", got))
 	}
 
-	require.Equal(t, len(tests), st.size)
-	st.Dump()
+	require.Equal(t, len(tests), st.Size())
+	require.NoError(t, st.Dump(ioutil.Discard))
 }
 
 func TestEvalPushInstruction(t *testing.T) {
@@ -214,10 +1098,232 @@ func TestEvalPushInstruction(t *testing.T) {
 	for _, tt := range tests {
 		v, err := testEval(t, tt.input, st)
 		require.NoError(t, err)
-		require.Equal(t, tt.want.V, v.V)
+		require.Equal(t, tt.want, v)
+	}
+
+	require.Equal(t, len(tests), st.Size())
+}
+
+func TestEvalProgram(t *testing.T) {
+	input := `push int32(33)
+; comment
+push int32(42)
+add
+push int8(2)
+dump`
+
+	p := parser.NewParser(input)
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+
+	st := NewStack()
+	_, err = testVM(st).Eval(pg)
+	require.NoError(t, err)
+	require.Equal(t, 2, st.Size())
+
+	v, err := st.Peek(0)
+	require.NoError(t, err)
+	testIntegerObject(t, v, NewInt8Value(2))
+	v, err = st.Peek(1)
+	require.NoError(t, err)
+	testIntegerObject(t, v, NewInt32Value(75))
+
+	p = parser.NewParser("push int8(1)\nexit\npush int8(2)")
+	pg, err = p.ParseProgram()
+	require.NoError(t, err)
+
+	st = NewStack()
+	_, err = testVM(st).Eval(pg)
+	require.Equal(t, ErrExit, err)
+	require.Equal(t, 1, st.Size())
+}
+
+func TestRuntimeError(t *testing.T) {
+	p := parser.NewParser("push int32(1)\n\npop\n  pop")
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+
+	_, err = testVM(NewStack()).Eval(pg)
+	require.Error(t, err)
+
+	rErr, ok := err.(*RuntimeError)
+	require.True(t, ok)
+	require.Equal(t, token.Position{Line: 4, Column: 3}, rErr.Pos)
+	require.Equal(t, "pop", rErr.Instruction)
+	require.Equal(t, 0, rErr.Depth)
+	require.Equal(t, "4:3: pop: error: pop on empty stack (stack depth 0)", rErr.Error())
+}
+
+func TestStep(t *testing.T) {
+	input := `push int32(3)
+call square
+exit
+square:
+	dup
+	mul
+	ret
+`
+	pg, err := parser.NewParser(input).ParseProgram()
+	require.NoError(t, err)
+
+	vm := NewVM(NewStack())
+	require.NoError(t, vm.Load(pg))
+
+	lines := []int{}
+	calls := []int{}
+	for !vm.Done() {
+		lines = append(lines, vm.Next().Pos().Line)
+		calls = append(calls, len(vm.Calls()))
+		_, err = vm.Step()
+		if err == ErrExit {
+			break
+		}
+		require.NoError(t, err)
 	}
 
-	require.Equal(t, len(tests), st.size)
+	require.Equal(t, []int{1, 2, 5, 6, 7, 3}, lines)
+	require.Equal(t, []int{0, 0, 1, 1, 1, 0}, calls)
+	require.Equal(t, []Value{NewInt32Value(9)}, vm.Stack.Values())
+
+	require.NoError(t, vm.Load(pg))
+	_, _ = vm.Step()
+	_, _ = vm.Step()
+	require.Equal(t, []token.Position{{Line: 2, Column: 1}}, vm.Calls())
+
+	pg, err = parser.NewParser("pop").ParseProgram()
+	require.NoError(t, err)
+	require.NoError(t, vm.Load(pg))
+	vm.Stack.Clear()
+	_, err = vm.Step()
+	var rerr *RuntimeError
+	require.True(t, errors.As(err, &rerr))
+	require.True(t, vm.Done())
+	_, err = vm.Step()
+	require.Error(t, err)
+}
+
+func TestTrace(t *testing.T) {
+	input := `push int32(2)
+dup
+mul
+push double(0.5)
+div
+mod`
+	pg, err := parser.NewParser(input).ParseProgram()
+	require.NoError(t, err)
+
+	var trace bytes.Buffer
+	vm := NewVM(NewStack())
+	vm.Trace = &trace
+	_, err = vm.Eval(pg)
+	require.Error(t, err)
+
+	require.Equal(t, `{"pos":"1:1","instruction":"push int32(2)","before":null,"after":{"type":"int32","value":"2"},"depth":1}
+{"pos":"2:1","instruction":"dup","before":{"type":"int32","value":"2"},"after":{"type":"int32","value":"2"},"depth":2}
+{"pos":"3:1","instruction":"mul","before":{"type":"int32","value":"2"},"after":{"type":"int32","value":"4"},"depth":1}
+{"pos":"4:1","instruction":"push double(0.5)","before":{"type":"int32","value":"4"},"after":{"type":"double","value":"0.5"},"depth":2}
+{"pos":"5:1","instruction":"div","before":{"type":"double","value":"0.5"},"after":{"type":"double","value":"0.125"},"depth":1}
+{"pos":"6:1","instruction":"mod","before":{"type":"double","value":"0.125"},"after":{"type":"double","value":"0.125"},"depth":1,"error":"error: mod requires at least 2 values on the stack: got 1"}
+`, trace.String())
+
+	var rec TraceRecord
+	line := strings.SplitN(trace.String(), "\n", 2)[0]
+	require.NoError(t, json.Unmarshal([]byte(line), &rec))
+	require.Equal(t, TraceRecord{Pos: "1:1", Instruction: "push int32(2)", After: &TraceValue{Type: "int32", Value: "2"}, Depth: 1}, rec)
+}
+
+func TestProfile(t *testing.T) {
+	input := `push int32(3)
+loop: push int32(-1)
+	add
+	dup
+	jnz loop
+pop`
+	pg, err := parser.NewParser(input).ParseProgram()
+	require.NoError(t, err)
+
+	vm := NewVM(NewStack())
+	vm.Profile = NewProfile()
+	_, err = vm.Eval(pg)
+	require.NoError(t, err)
+	require.Equal(t, 2, vm.Profile.MaxDepth)
+	require.False(t, vm.Profile.Start.IsZero())
+
+	counts := make(map[string]int64)
+	for _, e := range vm.Profile.ByInstruction() {
+		require.Zero(t, e.Line)
+		counts[e.Op] = e.Count
+	}
+	require.Equal(t, map[string]int64{"push": 4, "add": 3, "dup": 3, "jnz": 3, "pop": 1}, counts)
+
+	lines := make(map[int]int64)
+	for _, e := range vm.Profile.ByLine() {
+		require.Empty(t, e.Op)
+		lines[e.Line] = e.Count
+		if e.Line == 2 {
+			require.Equal(t, "push int32(-1)", e.Text)
+		}
+	}
+	require.Equal(t, map[int]int64{1: 1, 2: 3, 3: 3, 4: 3, 5: 3, 6: 1}, lines)
+	require.Len(t, vm.Profile.Entries(), 6)
+
+	var summary bytes.Buffer
+	require.NoError(t, vm.Profile.WriteSummary(&summary))
+	require.True(t, strings.HasPrefix(summary.String(), "instructions: 14, time: "))
+	require.Contains(t, summary.String(), "max stack depth: 2\n")
+
+	var pprof bytes.Buffer
+	require.NoError(t, vm.Profile.WritePprof(&pprof))
+	zr, err := gzip.NewReader(&pprof)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	for _, s := range []string{"instructions", "nanoseconds", "push", "jnz", "max stack depth: 2"} {
+		require.Contains(t, string(data), s)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	p := parser.NewParser("push int8(1)\npush int8(2)\npush int8(3)")
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+
+	vm := testVM(NewStack())
+	vm.MaxInstructions = 2
+	_, err = vm.Eval(pg)
+	hErr, ok := err.(*HaltError)
+	require.True(t, ok)
+	require.Equal(t, 2, hErr.Executed)
+	require.Equal(t, token.Position{Line: 3, Column: 1}, hErr.Pos)
+	require.True(t, errors.Is(err, ErrInstructionLimit))
+	require.Equal(t, "3:1: halted after 2 instructions: error: instruction limit exceeded", err.Error())
+	require.Equal(t, 2, vm.Stack.Size())
+
+	// labels are not instructions
+	vm = testVM(NewStack())
+	vm.MaxInstructions = 2
+	_, err = testEvalVM(t, "start:\npush int8(1)\nend: push int8(2)\ndone:", vm)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vm = testVM(NewStack())
+	_, err = vm.EvalContext(ctx, pg)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, 0, vm.Stack.Size())
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	vm = testVM(NewStack())
+	_, err = vm.EvalContext(ctx, pg)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, 0, vm.Stack.Size())
+
+	// the loop only ends when the timeout expires
+	vm = testVM(NewStack())
+	vm.Timeout = time.Millisecond
+	_, err = testEvalVM(t, "loop:\njmp loop", vm)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
 }
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -239,12 +1345,23 @@ func TestEvalIntegerExpression(t *testing.T) {
 
 func testIntegerObject(t *testing.T, v Value, want Value) {
 	require.Equal(t, want.Type.String(), v.Type.String())
-	require.Equal(t, want.V, v.V)
+	require.Equal(t, want, v)
 }
 
 func testEval(t *testing.T, input string, st *Stack) (Value, error) {
+	return testEvalVM(t, input, testVM(st))
+}
+
+func testEvalVM(t *testing.T, input string, vm *VM) (Value, error) {
 	p := parser.NewParser(input)
 	pg, err := p.ParseInstruction()
 	require.NoError(t, err)
-	return st.Eval(pg)
+	return vm.Eval(pg)
+}
+
+func testVM(st *Stack) *VM {
+	vm := NewVM(st)
+	vm.Stdout = ioutil.Discard
+	vm.Stderr = ioutil.Discard
+	return vm
 }
@@ -0,0 +1,158 @@
+package evaluator
+
+import (
+	"avm/ast"
+	"avm/token"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxCallDepth is the number of nested calls allowed by a VM returned
+// by NewVM.
+const DefaultMaxCallDepth = 1024
+
+var (
+	// ErrCallDepth is returned by call when the number of nested calls
+	// would exceed VM.MaxCallDepth.
+	ErrCallDepth = errors.New("error: maximum call depth exceeded")
+
+	// ErrEmptyReturnStack is returned by ret outside of a subroutine.
+	ErrEmptyReturnStack = errors.New("error: ret with an empty return stack")
+)
+
+// ResolveLabels returns the index in stmts of the statement defined by each
+// label. It returns a *LabelError when a label is defined twice or when a
+// jump or a call refers to a label which is not defined.
+func ResolveLabels(stmts []ast.Statement) (map[string]int, error) {
+	labels := make(map[string]int)
+	for i, stmt := range stmts {
+		l, ok := stmt.(*ast.LabelStatement)
+		if !ok {
+			continue
+		}
+
+		if _, ok := labels[l.Name.Value]; ok {
+			return nil, &LabelError{Pos: l.Pos(), Label: l.Name.Value, Err: ErrDuplicateLabel}
+		}
+		labels[l.Name.Value] = i
+	}
+
+	for _, stmt := range stmts {
+		var label *ast.Identifier
+		switch s := stmt.(type) {
+		case *ast.JumpStatement:
+			label = s.Label
+		case *ast.CallStatement:
+			label = s.Label
+		default:
+			continue
+		}
+
+		if _, ok := labels[label.Value]; !ok {
+			return nil, &LabelError{Pos: stmt.Pos(), Label: label.Value, Err: ErrUndefinedLabel}
+		}
+	}
+
+	return labels, nil
+}
+
+// evalJump moves the program counter to the label of the jump.
+func (vm *VM) evalJump(stmt *ast.JumpStatement) (Value, error) {
+	target, ok := vm.labels[stmt.Label.Value]
+	if !ok {
+		return Value{}, fmt.Errorf("error: %s %q", ErrUndefinedLabel, stmt.Label.Value)
+	}
+
+	return vm.jump(stmt.Token.Type, target)
+}
+
+// jump moves the program counter to target. Conditional jumps pop the value
+// at the top of the stack and only jump when it is zero (jz), not zero (jnz),
+// negative (jlt) or positive (jgt).
+func (vm *VM) jump(op token.TokenType, target int) (Value, error) {
+	if op == token.JMP {
+		vm.pc = target
+		return Value{}, nil
+	}
+
+	v, err := vm.Stack.Pop()
+	if err != nil {
+		return Value{}, fmt.Errorf("error: %s on empty stack", op)
+	}
+
+	s := sign(v)
+	var jump bool
+	switch op {
+	case token.JZ:
+		jump = s == 0
+	case token.JNZ:
+		jump = s != 0
+	case token.JLT:
+		jump = s < 0
+	case token.JGT:
+		jump = s > 0
+	}
+
+	if jump {
+		vm.pc = target
+	}
+
+	return v, nil
+}
+
+// evalCall saves the index of the next statement on the return stack and
+// jumps to the label of the call.
+func (vm *VM) evalCall(stmt *ast.CallStatement) (Value, error) {
+	target, ok := vm.labels[stmt.Label.Value]
+	if !ok {
+		return Value{}, fmt.Errorf("error: %s %q", ErrUndefinedLabel, stmt.Label.Value)
+	}
+
+	return vm.call(target)
+}
+
+// call saves the index of the next instruction on the return stack and moves
+// the program counter to target.
+func (vm *VM) call(target int) (Value, error) {
+	if vm.MaxCallDepth > 0 && len(vm.returns) >= vm.MaxCallDepth {
+		return Value{}, fmt.Errorf("%w: %d", ErrCallDepth, vm.MaxCallDepth)
+	}
+
+	vm.returns = append(vm.returns, vm.pc)
+	vm.pc = target
+	return Value{}, nil
+}
+
+// evalRet continues the execution after the last call.
+func (vm *VM) evalRet() (Value, error) {
+	if len(vm.returns) == 0 {
+		return Value{}, ErrEmptyReturnStack
+	}
+
+	vm.pc = vm.returns[len(vm.returns)-1]
+	vm.returns = vm.returns[:len(vm.returns)-1]
+	return Value{}, nil
+}
+
+// sign returns -1, 0 or 1 depending on whether v is negative, zero or
+// positive.
+func sign(v Value) int {
+	var f float64
+	switch v.Type {
+	case FloatValue, DoubleValue:
+		f = v.f
+	case BigDecimalValue:
+		return v.d.Sign()
+	default:
+		f = float64(v.i)
+	}
+
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,248 @@
+package evaluator
+
+import (
+	"avm/token"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+var errNegativeExponent = errors.New("error: negative exponent on an integer")
+
+var minOp = binaryOp{
+	name: token.MIN,
+	integer: func(a, b int64) (int64, error) {
+		if b < a {
+			return b, nil
+		}
+		return a, nil
+	},
+	float: func(a, b float64) (float64, error) { return math.Min(a, b), nil },
+	decimal: func(a, b *big.Rat) (*big.Rat, error) {
+		if b.Cmp(a) < 0 {
+			return b, nil
+		}
+		return a, nil
+	},
+}
+
+var maxOp = binaryOp{
+	name: token.MAX,
+	integer: func(a, b int64) (int64, error) {
+		if b > a {
+			return b, nil
+		}
+		return a, nil
+	},
+	float: func(a, b float64) (float64, error) { return math.Max(a, b), nil },
+	decimal: func(a, b *big.Rat) (*big.Rat, error) {
+		if b.Cmp(a) > 0 {
+			return b, nil
+		}
+		return a, nil
+	},
+}
+
+// floatFuncs implements the math instructions which only apply to float and
+// double values. The functions report the values outside of their domain
+// instead of returning NaN.
+var floatFuncs = map[token.TokenType]func(x float64) (float64, error){
+	token.SQRT: func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, fmt.Errorf("error: %w: sqrt of a negative value", ErrDomain)
+		}
+		return math.Sqrt(x), nil
+	},
+	token.EXP: func(x float64) (float64, error) { return math.Exp(x), nil },
+	token.LOG: func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("error: %w: log of a value lower or equal to zero", ErrDomain)
+		}
+		return math.Log(x), nil
+	},
+	token.SIN: func(x float64) (float64, error) {
+		if math.IsInf(x, 0) {
+			return 0, fmt.Errorf("error: %w: sin of an infinite value", ErrDomain)
+		}
+		return math.Sin(x), nil
+	},
+	token.COS: func(x float64) (float64, error) {
+		if math.IsInf(x, 0) {
+			return 0, fmt.Errorf("error: %w: cos of an infinite value", ErrDomain)
+		}
+		return math.Cos(x), nil
+	},
+}
+
+// evalMath applies a math instruction to the values at the top of the stack
+// and stacks the result. min and max promote their operands like arithmetic
+// instructions, pow unstacks the base then its integer exponent and returns a
+// value of the type of the base. The operands are left on the stack when the
+// instruction fails.
+func (vm *VM) evalMath(op token.TokenType) (Value, error) {
+	switch op {
+	case token.MIN:
+		return vm.evalBinary(minOp)
+	case token.MAX:
+		return vm.evalBinary(maxOp)
+	case token.POW:
+		return vm.evalPow()
+	}
+
+	name := string(op)
+	if vm.Stack.IsEmpty() {
+		return Value{}, fmt.Errorf("error: %s on empty stack", name)
+	}
+
+	a, _ := vm.Stack.Peek(0)
+	var v Value
+	var err error
+	switch op {
+	case token.NEG:
+		v, err = vm.negate(name, a)
+	case token.ABS:
+		v, err = vm.absolute(name, a)
+	default:
+		fn, ok := floatFuncs[op]
+		if !ok {
+			return Value{}, fmt.Errorf("error: unknown math instruction %s", name)
+		}
+
+		if a.Type != FloatValue && a.Type != DoubleValue {
+			return Value{}, &TypeError{Op: name, Type: a.Type, Want: "float or double operands"}
+		}
+
+		x, _ := a.ConvertToDouble()
+		var r float64
+		if r, err = fn(x); err == nil {
+			v, err = vm.newFloat(name, a.Type, r)
+		}
+	}
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	vm.Stack.replace(1, v)
+	return v, nil
+}
+
+// negate returns the opposite of v. The opposite of the smallest value of an
+// integer type is handled according to the arithmetic mode of the VM.
+func (vm *VM) negate(op string, v Value) (Value, error) {
+	switch v.Type {
+	case BigDecimalValue:
+		return NewBigDecimalValue(new(big.Rat).Neg(v.d)), nil
+	case FloatValue, DoubleValue:
+		return Value{Type: v.Type, f: -v.f}, nil
+	}
+
+	return vm.newInteger(op, v.Type, -v.i)
+}
+
+// absolute returns the absolute value of v. Like for negate, the absolute
+// value of the smallest value of an integer type depends on the arithmetic
+// mode of the VM.
+func (vm *VM) absolute(op string, v Value) (Value, error) {
+	if v.IsFloat() {
+		return Value{Type: v.Type, f: math.Abs(v.f)}, nil
+	}
+
+	if sign(v) < 0 {
+		return vm.negate(op, v)
+	}
+
+	return v, nil
+}
+
+// evalPow unstacks the base and its exponent, which must be an integer, and
+// stacks the base raised to the exponent.
+func (vm *VM) evalPow() (Value, error) {
+	if vm.Stack.Size() < 2 {
+		return Value{}, fmt.Errorf("error: %s requires at least 2 values on the stack: got %d", token.POW, vm.Stack.Size())
+	}
+
+	a, _ := vm.Stack.Peek(0)
+	b, _ := vm.Stack.Peek(1)
+	if _, ok := integerRanges[b.Type]; !ok {
+		return Value{}, &TypeError{Op: token.POW, Type: b.Type, Want: "an integer exponent"}
+	}
+
+	ie, _ := b.ConvertToInteger()
+	e := int64(ie)
+
+	var v Value
+	var err error
+	switch a.Type {
+	case BigDecimalValue:
+		v, err = powDecimal(a.d, e)
+	case FloatValue, DoubleValue:
+		if a.f == 0 && e < 0 {
+			return Value{}, errDivideByZero
+		}
+
+		v, err = vm.newFloat(token.POW, a.Type, math.Pow(a.f, float64(e)))
+	default:
+		v, err = vm.powInteger(a.Type, a.i, e)
+	}
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	vm.Stack.replace(2, v)
+	return v, nil
+}
+
+// powInteger returns base raised to e as a value of the integer type t,
+// handling results outside of its range according to the arithmetic mode of
+// the VM.
+func (vm *VM) powInteger(t ValueType, base, e int64) (Value, error) {
+	if e < 0 {
+		return Value{}, errNegativeExponent
+	}
+
+	x, y := big.NewInt(base), big.NewInt(e)
+	if vm.Mode == WrappingArithmetic {
+		// the low 64 bits are enough to truncate to any integer type
+		m := new(big.Int).Lsh(big.NewInt(1), 64)
+		r := new(big.Int).Exp(x, y, m)
+		return truncateInteger(t, int64(r.Uint64())), nil
+	}
+
+	// beyond 63, the result of a base other than -1, 0 or 1 cannot fit in
+	// an int64 and is clamped, which is enough to overflow any integer type
+	var r int64
+	if (base < -1 || base > 1) && e > 63 {
+		r = math.MaxInt64
+		if base < 0 && e%2 == 1 {
+			r = math.MinInt64
+		}
+	} else if z := new(big.Int).Exp(x, y, nil); z.IsInt64() {
+		r = z.Int64()
+	} else if z.Sign() < 0 {
+		r = math.MinInt64
+	} else {
+		r = math.MaxInt64
+	}
+
+	return vm.newInteger(token.POW, t, r)
+}
+
+// powDecimal returns x raised to e, inverting x for negative exponents.
+func powDecimal(x *big.Rat, e int64) (Value, error) {
+	if e < 0 {
+		if x.Sign() == 0 {
+			return Value{}, errDivideByZero
+		}
+
+		x = new(big.Rat).Inv(x)
+		e = -e
+	}
+
+	y := big.NewInt(e)
+	num := new(big.Int).Exp(x.Num(), y, nil)
+	denom := new(big.Int).Exp(x.Denom(), y, nil)
+	return NewBigDecimalValue(new(big.Rat).SetFrac(num, denom)), nil
+}
@@ -0,0 +1,162 @@
+package evaluator
+
+import (
+	"avm/token"
+	"fmt"
+)
+
+// Opcode identifies an instruction of a compiled program. Its name is the
+// token type of the instruction, e.g. push.
+type Opcode byte
+
+const (
+	OpPush Opcode = iota + 1
+	OpPop
+	OpDump
+	OpClear
+	OpDup
+	OpSwap
+	OpAssert
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPrint
+	OpExit
+	OpJmp
+	OpJz
+	OpJnz
+	OpJlt
+	OpJgt
+	OpEq
+	OpNeq
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+	OpCall
+	OpRet
+	OpStore
+	OpLoad
+	OpAnd
+	OpOr
+	OpXor
+	OpNot
+	OpShl
+	OpShr
+	OpSar
+	OpNeg
+	OpAbs
+	OpMin
+	OpMax
+	OpPow
+	OpSqrt
+	OpExp
+	OpLog
+	OpSin
+	OpCos
+	OpCast
+	OpOver
+	OpRot
+	OpPick
+	OpRoll
+	OpDrop
+	OpDepth
+)
+
+var opcodeNames = map[Opcode]string{
+	OpPush:   token.PUSH,
+	OpPop:    token.POP,
+	OpDump:   token.DUMP,
+	OpClear:  token.CLEAR,
+	OpDup:    token.DUP,
+	OpSwap:   token.SWAP,
+	OpAssert: token.ASSERT,
+	OpAdd:    token.ADD,
+	OpSub:    token.SUB,
+	OpMul:    token.MUL,
+	OpDiv:    token.DIV,
+	OpMod:    token.MOD,
+	OpPrint:  token.PRINT,
+	OpExit:   token.EXIT,
+	OpJmp:    token.JMP,
+	OpJz:     token.JZ,
+	OpJnz:    token.JNZ,
+	OpJlt:    token.JLT,
+	OpJgt:    token.JGT,
+	OpEq:     token.CMPEQ,
+	OpNeq:    token.CMPNEQ,
+	OpLt:     token.CMPLT,
+	OpLe:     token.CMPLE,
+	OpGt:     token.CMPGT,
+	OpGe:     token.CMPGE,
+	OpCall:   token.CALL,
+	OpRet:    token.RET,
+	OpStore:  token.STORE,
+	OpLoad:   token.LOAD,
+	OpAnd:    token.AND,
+	OpOr:     token.OR,
+	OpXor:    token.XOR,
+	OpNot:    token.NOT,
+	OpShl:    token.SHL,
+	OpShr:    token.SHR,
+	OpSar:    token.SAR,
+	OpNeg:    token.NEG,
+	OpAbs:    token.ABS,
+	OpMin:    token.MIN,
+	OpMax:    token.MAX,
+	OpPow:    token.POW,
+	OpSqrt:   token.SQRT,
+	OpExp:    token.EXP,
+	OpLog:    token.LOG,
+	OpSin:    token.SIN,
+	OpCos:    token.COS,
+	OpCast:   token.CAST,
+	OpOver:   token.OVER,
+	OpRot:    token.ROT,
+	OpPick:   token.PICK,
+	OpRoll:   token.ROLL,
+	OpDrop:   token.DROP,
+	OpDepth:  token.DEPTH,
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("opcode(%d)", byte(op))
+}
+
+// HasOperand reports whether the instruction refers to a constant, a label,
+// a variable, a type or has a count.
+func (op Opcode) HasOperand() bool {
+	return op == OpPush || op == OpAssert || op.HasLabel() || op.HasVariable() || op.HasType() || op.HasCount()
+}
+
+// HasCount reports whether the operand of the instruction is a count.
+func (op Opcode) HasCount() bool {
+	return op == OpPick || op == OpRoll || op == OpDrop
+}
+
+// HasType reports whether the operand of the instruction is a type.
+func (op Opcode) HasType() bool {
+	return op == OpCast
+}
+
+// HasVariable reports whether the operand of the instruction is a variable.
+func (op Opcode) HasVariable() bool {
+	return op == OpStore || op == OpLoad
+}
+
+// HasLabel reports whether the operand of the instruction is a label.
+func (op Opcode) HasLabel() bool {
+	return op >= OpJmp && op <= OpJgt || op == OpCall
+}
+
+// Valid reports whether op is a known instruction.
+func (op Opcode) Valid() bool {
+	_, ok := opcodeNames[op]
+	return ok
+}
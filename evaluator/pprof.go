@@ -0,0 +1,176 @@
+package evaluator
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Field numbers of the messages of the pprof format, see
+// https://github.com/google/pprof/blob/master/proto/profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileComment       = 13
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// protoBuffer encodes the fields of a protocol buffer message.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// key writes the key of a field, wire type 0 for varints and 2 for bytes.
+func (b *protoBuffer) key(field, wire int) {
+	b.varint(uint64(field<<3 | wire))
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	if x == 0 {
+		return
+	}
+
+	b.key(field, 0)
+	b.varint(uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// int64s writes a packed repeated field.
+func (b *protoBuffer) int64s(field int, xs ...int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+
+	b.bytes(field, packed.data)
+}
+
+// message writes the message encoded by fn.
+func (b *protoBuffer) message(field int, fn func(m *protoBuffer)) {
+	var m protoBuffer
+	fn(&m)
+	b.bytes(field, m.data)
+}
+
+// WritePprof writes the profile to w in the gzipped protocol buffer format of
+// pprof. Each instruction is a function named after its kind, e.g. push, and
+// each sample counts the executions and the time of the instructions of a kind
+// on a source line, so that pprof can report both.
+//
+//	go tool pprof -top -lines out.pprof
+func (p *Profile) WritePprof(w io.Writer) error {
+	var b protoBuffer
+	index := map[string]int64{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		i, ok := index[s]
+		if !ok {
+			i = int64(len(table))
+			index[s] = i
+			table = append(table, s)
+		}
+
+		return i
+	}
+
+	b.message(profileSampleType, func(m *protoBuffer) {
+		m.int64(valueTypeType, str("instructions"))
+		m.int64(valueTypeUnit, str("count"))
+	})
+	b.message(profileSampleType, func(m *protoBuffer) {
+		m.int64(valueTypeType, str("time"))
+		m.int64(valueTypeUnit, str("nanoseconds"))
+	})
+
+	type function struct{ op, filename string }
+	functions := make(map[function]int64)
+	var total int64
+	for i, e := range p.Entries() {
+		f := function{e.Op, e.Filename}
+		id, ok := functions[f]
+		if !ok {
+			id = int64(len(functions) + 1)
+			functions[f] = id
+			b.message(profileFunction, func(m *protoBuffer) {
+				m.int64(functionID, id)
+				m.int64(functionName, str(e.Op))
+				m.int64(functionSystemName, str(e.Op))
+				m.int64(functionFilename, str(e.Filename))
+			})
+		}
+
+		// one location per sample, ids start at 1
+		loc := int64(i + 1)
+		b.message(profileLocation, func(m *protoBuffer) {
+			m.int64(locationID, loc)
+			m.message(locationLine, func(l *protoBuffer) {
+				l.int64(lineFunctionID, id)
+				l.int64(lineLine, int64(e.Line))
+			})
+		})
+		b.message(profileSample, func(m *protoBuffer) {
+			m.int64s(sampleLocationID, loc)
+			m.int64s(sampleValue, e.Count, int64(e.Time))
+		})
+		total += int64(e.Time)
+	}
+
+	if !p.Start.IsZero() {
+		b.int64(profileTimeNanos, p.Start.UnixNano())
+	}
+	b.int64(profileDurationNanos, total)
+	b.message(profilePeriodType, func(m *protoBuffer) {
+		m.int64(valueTypeType, str("instructions"))
+		m.int64(valueTypeUnit, str("count"))
+	})
+	b.int64(profilePeriod, 1)
+	b.int64s(profileComment, str(fmt.Sprintf("max stack depth: %d", p.MaxDepth)))
+
+	// the string table is written last since the other fields add to it
+	for _, s := range table {
+		b.bytes(profileStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,191 @@
+package evaluator
+
+import (
+	"avm/token"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Profile collects how many times each instruction of a program is executed
+// and how long it runs, while set as VM.Profile. The same profile can collect
+// several programs.
+type Profile struct {
+	// MaxDepth is the maximum number of values on the stack.
+	MaxDepth int
+
+	// Start is the time the first instruction was executed.
+	Start time.Time
+
+	entries map[profileKey]*ProfileEntry
+}
+
+// profileKey identifies the instructions of a kind on a source line.
+type profileKey struct {
+	filename string
+	line     int
+	op       string
+}
+
+// ProfileEntry holds the statistics of an instruction on a source line, of
+// every instruction of a kind or of every instruction on a line.
+type ProfileEntry struct {
+	Op       string // instruction name, e.g. push, empty for a whole line
+	Filename string // empty for a whole kind of instruction
+	Line     int    // 0 for a whole kind of instruction
+	Text     string // first instruction of the kind, or of any kind, on the line
+
+	Count int64         // number of executions
+	Time  time.Duration // cumulative time of the executions
+
+	column int // column of Text
+}
+
+// NewProfile returns an empty profile.
+func NewProfile() *Profile {
+	return &Profile{entries: make(map[profileKey]*ProfileEntry)}
+}
+
+// record adds an execution of the instruction op at pos, whose text is text,
+// which took d and left depth values on the stack.
+func (p *Profile) record(pos token.Position, op, text string, start time.Time, d time.Duration, depth int) {
+	if p.Start.IsZero() {
+		p.Start = start
+	}
+
+	if depth > p.MaxDepth {
+		p.MaxDepth = depth
+	}
+
+	k := profileKey{filename: pos.Filename, line: pos.Line, op: op}
+	e, ok := p.entries[k]
+	if !ok {
+		e = &ProfileEntry{Op: k.op, Filename: k.filename, Line: k.line, Text: text, column: pos.Column}
+		p.entries[k] = e
+	}
+
+	e.Count++
+	e.Time += d
+}
+
+// Entries returns the statistics of each kind of instruction on each line,
+// from the longest to run.
+func (p *Profile) Entries() []ProfileEntry {
+	entries := make([]ProfileEntry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, *e)
+	}
+
+	sortEntries(entries)
+	return entries
+}
+
+// ByInstruction returns the statistics of each kind of instruction, from the
+// longest to run.
+func (p *Profile) ByInstruction() []ProfileEntry {
+	return p.merge(func(k profileKey) profileKey {
+		return profileKey{op: k.op}
+	})
+}
+
+// ByLine returns the statistics of each source line, from the longest to run.
+func (p *Profile) ByLine() []ProfileEntry {
+	return p.merge(func(k profileKey) profileKey {
+		return profileKey{filename: k.filename, line: k.line}
+	})
+}
+
+// merge adds up the entries whose keys are the same once passed to key.
+func (p *Profile) merge(key func(profileKey) profileKey) []ProfileEntry {
+	merged := make(map[profileKey]*ProfileEntry)
+	var entries []ProfileEntry
+	for _, e := range p.entries {
+		k := key(profileKey{filename: e.Filename, line: e.Line, op: e.Op})
+		m, ok := merged[k]
+		if !ok {
+			m = &ProfileEntry{Op: k.op, Filename: k.filename, Line: k.line}
+			merged[k] = m
+		}
+
+		if k.line > 0 && (m.Text == "" || e.column < m.column) {
+			m.Text, m.column = e.Text, e.column
+		}
+
+		m.Count += e.Count
+		m.Time += e.Time
+	}
+
+	for _, m := range merged {
+		entries = append(entries, *m)
+	}
+
+	sortEntries(entries)
+	return entries
+}
+
+// sortEntries sorts entries from the longest to run, then by position and
+// instruction name so that the order is stable.
+func sortEntries(entries []ProfileEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.Time != b.Time:
+			return a.Time > b.Time
+		case a.Filename != b.Filename:
+			return a.Filename < b.Filename
+		case a.Line != b.Line:
+			return a.Line < b.Line
+		}
+
+		return a.Op < b.Op
+	})
+}
+
+// WriteSummary writes the statistics of each kind of instruction and of each
+// source line to w as tables.
+//
+//	instructions: 5, time: 12µs, max stack depth: 2
+//
+//	count  time   %      instruction
+//	2      8µs    66.67  push
+func (p *Profile) WriteSummary(w io.Writer) error {
+	var count int64
+	var total time.Duration
+	for _, e := range p.entries {
+		count += e.Count
+		total += e.Time
+	}
+
+	percent := func(d time.Duration) float64 {
+		if total == 0 {
+			return 0
+		}
+
+		return 100 * float64(d) / float64(total)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "instructions: %d, time: %s, max stack depth: %d\n\n", count, total, p.MaxDepth)
+	fmt.Fprintln(tw, "count\ttime\t%\tinstruction")
+	for _, e := range p.ByInstruction() {
+		fmt.Fprintf(tw, "%d\t%s\t%.2f\t%s\n", e.Count, e.Time, percent(e.Time), e.Op)
+	}
+
+	fmt.Fprintln(tw, "\ncount\ttime\t%\tline")
+	for _, e := range p.ByLine() {
+		fmt.Fprintf(tw, "%d\t%s\t%.2f\t%s\n", e.Count, e.Time, percent(e.Time), e.location()+"  "+e.Text)
+	}
+
+	return tw.Flush()
+}
+
+// location returns the source line of e as file:line, or line without file.
+func (e ProfileEntry) location() string {
+	if e.Filename == "" {
+		return fmt.Sprint(e.Line)
+	}
+
+	return fmt.Sprintf("%s:%d", e.Filename, e.Line)
+}
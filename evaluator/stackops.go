@@ -0,0 +1,48 @@
+package evaluator
+
+import (
+	"avm/token"
+	"fmt"
+)
+
+// evalStack evaluates the Forth-style stack instructions:
+//
+//	over     ( a b -- a b a ) copies the second value to the top
+//	rot      ( a b c -- b c a ) moves the third value to the top
+//	pick n   copies the value at the index n to the top, pick 0 is dup
+//	roll n   moves the value at the index n to the top, roll 1 is swap
+//	drop n   removes the first n values
+//	depth    stacks the size of the stack as an int32
+//
+// The top of the stack is on the right in the comments, and at the index 0.
+func (vm *VM) evalStack(op token.TokenType, n int) (Value, error) {
+	var err error
+	switch op {
+	case token.OVER:
+		if vm.Stack.Size() < 2 {
+			return Value{}, fmt.Errorf("error: over requires at least 2 values on the stack: got %d", vm.Stack.Size())
+		}
+		err = vm.Stack.Pick(1)
+	case token.ROT:
+		if vm.Stack.Size() < 3 {
+			return Value{}, fmt.Errorf("error: rot requires at least 3 values on the stack: got %d", vm.Stack.Size())
+		}
+		err = vm.Stack.Roll(2)
+	case token.PICK:
+		err = vm.Stack.Pick(n)
+	case token.ROLL:
+		err = vm.Stack.Roll(n)
+	case token.DROP:
+		err = vm.Stack.Drop(n)
+	case token.DEPTH:
+		err = vm.Stack.Push(NewInt32Value(int32(vm.Stack.Size())))
+	default:
+		return Value{}, fmt.Errorf("error: unknown stack instruction %s", op)
+	}
+
+	if err != nil || vm.Stack.IsEmpty() {
+		return Value{}, err
+	}
+
+	return vm.Stack.Peek(0)
+}
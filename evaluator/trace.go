@@ -0,0 +1,54 @@
+package evaluator
+
+import (
+	"avm/token"
+	"encoding/json"
+)
+
+// TraceRecord describes an instruction executed while VM.Trace is set. It is
+// written as one line of JSON.
+type TraceRecord struct {
+	Pos         string      `json:"pos"`
+	Instruction string      `json:"instruction"`
+	Before      *TraceValue `json:"before"` // top of the stack, null when empty
+	After       *TraceValue `json:"after"`
+	Depth       int         `json:"depth"` // number of values on the stack after the instruction
+	Error       string      `json:"error,omitempty"`
+}
+
+// TraceValue is a value of a TraceRecord.
+type TraceValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// top returns the value at the top of the stack as a TraceValue, or nil when
+// the stack is empty.
+func (vm *VM) top() *TraceValue {
+	v, err := vm.Stack.Peek(0)
+	if err != nil {
+		return nil
+	}
+
+	return &TraceValue{Type: v.Type.String(), Value: v.Literal()}
+}
+
+// trace writes the record of the instruction at pos to vm.Trace, text being
+// the instruction, before the top of the stack before it was executed and err
+// its error.
+func (vm *VM) trace(pos token.Position, text string, before *TraceValue, err error) {
+	rec := TraceRecord{
+		Pos:         pos.String(),
+		Instruction: text,
+		Before:      before,
+		After:       vm.top(),
+		Depth:       vm.Stack.Size(),
+	}
+	if err != nil && err != ErrExit {
+		rec.Error = err.Error()
+	}
+
+	// like debug traces, a trace which cannot be written does not stop the
+	// program
+	_ = json.NewEncoder(vm.Trace).Encode(rec)
+}
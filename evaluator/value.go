@@ -1,26 +1,55 @@
 package evaluator
 
-import "fmt"
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
 
 type ValueType uint8
 
 const (
 	CharValue ValueType = 0x10
 
-	ShortValue = 0x20
+	ShortValue ValueType = 0x20
 
 	// integer family: 0x10 to 0x1F
-	IntegerValue = 0x30
+	IntegerValue ValueType = 0x30
 
-	FloatValue = 0x40
+	FloatValue ValueType = 0x40
 
 	// double family: 0x20 to 0x2F
-	DoubleValue = 0x50
+	DoubleValue ValueType = 0x50
+
+	// arbitrary precision decimal, stored as a *big.Rat
+	BigDecimalValue ValueType = 0x60
 )
 
+// promotionRank orders the operand types from the narrowest to the widest:
+// int8 < int16 < int32 < float < double < bigdecimal. An operand is only ever
+// promoted to a type of a higher rank.
+var promotionRank = map[ValueType]int{
+	CharValue:       0,
+	ShortValue:      1,
+	IntegerValue:    2,
+	FloatValue:      3,
+	DoubleValue:     4,
+	BigDecimalValue: 5,
+}
+
+// decimalPrecision is the number of fractional digits displayed for a
+// bigdecimal that has no finite decimal representation (e.g. 1/3).
+const decimalPrecision = 34
+
+// Value is a typed value. It is a tagged union: Type tells which of the
+// payloads holds the value, so that values can be copied and computed on
+// without being boxed in an interface.
 type Value struct {
-	V    interface{}
 	Type ValueType
+	i    int64    // int8, int16 and int32 values
+	f    float64  // float and double values, a float being exactly converted
+	d    *big.Rat // bigdecimal values
 }
 
 func (t ValueType) String() string {
@@ -35,51 +64,145 @@ func (t ValueType) String() string {
 		return "float"
 	case DoubleValue:
 		return "double"
+	case BigDecimalValue:
+		return "bigdecimal"
+	}
+
+	return ""
+}
+
+// String returns the string representation of the value.
+func (v Value) String() string {
+	return fmt.Sprintf("{%s %s}", v.Literal(), v.Type)
+}
+
+// Literal returns the value as written in the operand of an instruction,
+// e.g. 42 for push int32(42).
+func (v Value) Literal() string {
+	switch v.Type {
+	case CharValue, ShortValue, IntegerValue:
+		return strconv.FormatInt(v.i, 10)
+	case FloatValue:
+		return fmt.Sprint(float32(v.f))
+	case DoubleValue:
+		return fmt.Sprint(v.f)
+	case BigDecimalValue:
+		return formatDecimal(v.d)
 	}
 
 	return ""
 }
 
+// Int returns the value of an int8, int16 or int32, 0 for the other types.
+func (v Value) Int() int64 {
+	return v.i
+}
+
+// Float returns the value of a float or a double, 0 for the other types.
+func (v Value) Float() float64 {
+	return v.f
+}
+
+// Decimal returns the value of a bigdecimal, nil for the other types. The
+// value must not be modified.
+func (v Value) Decimal() *big.Rat {
+	return v.d
+}
+
+// IsInteger reports whether v is an int8, an int16 or an int32.
+func (v Value) IsInteger() bool {
+	return v.Type == CharValue || v.Type == ShortValue || v.Type == IntegerValue
+}
+
+// IsFloat reports whether v is a float or a double.
+func (v Value) IsFloat() bool {
+	return v.Type == FloatValue || v.Type == DoubleValue
+}
+
+// Equal reports whether v and w have the same type and value. Like for the
+// == operator, NaN is not equal to itself.
+func (v Value) Equal(w Value) bool {
+	if v.Type != w.Type {
+		return false
+	}
+
+	switch v.Type {
+	case FloatValue, DoubleValue:
+		return v.f == w.f
+	case BigDecimalValue:
+		return v.d.Cmp(w.d) == 0
+	}
+
+	return v.i == w.i
+}
+
 func NewInt8Value(x int8) Value {
-	return Value{V: x,
-		Type: CharValue}
+	return Value{Type: CharValue, i: int64(x)}
 }
 
 func NewInt16Value(x int16) Value {
-	return Value{V: x,
-		Type: ShortValue}
+	return Value{Type: ShortValue, i: int64(x)}
 }
 
 func NewInt32Value(x int32) Value {
-	return Value{V: int32(x), Type: IntegerValue}
+	return Value{Type: IntegerValue, i: int64(x)}
 }
 
 func NewFloatValue(x float32) Value {
-	return Value{V: x,
-		Type: FloatValue}
+	return Value{Type: FloatValue, f: float64(x)}
 }
 
 func NewDoubleValue(x float64) Value {
-	return Value{V: x,
-		Type: DoubleValue}
+	return Value{Type: DoubleValue, f: x}
 }
 
+func NewBigDecimalValue(x *big.Rat) Value {
+	return Value{Type: BigDecimalValue, d: x}
+}
+
+// GetBiggerType returns the wider of the types of a and b.
 func GetBiggerType(a, b Value) ValueType {
-	if a.Type > b.Type {
+	if promotionRank[a.Type] > promotionRank[b.Type] {
 		return a.Type
 	}
 
 	return b.Type
 }
 
-func (v Value) ConvertToInteger() (int32, error) {
-	switch v.Type {
+// Promote returns v converted to the type t, which must not be narrower than
+// the type of v.
+func (v Value) Promote(t ValueType) (Value, error) {
+	rank, ok := promotionRank[t]
+	if !ok || rank < promotionRank[v.Type] {
+		return Value{}, fmt.Errorf("cannot promote %s into %s", v.Type, t)
+	}
+
+	switch t {
 	case CharValue:
-		return int32(v.V.(int8)), nil
+		x, err := v.ConvertToChar()
+		return NewInt8Value(x), err
 	case ShortValue:
-		return int32(v.V.(int16)), nil
+		x, err := v.ConvertToShort()
+		return NewInt16Value(x), err
 	case IntegerValue:
-		return int32(v.V.(int32)), nil
+		x, err := v.ConvertToInteger()
+		return NewInt32Value(x), err
+	case FloatValue:
+		x, err := v.ConvertToFloat()
+		return NewFloatValue(x), err
+	case DoubleValue:
+		x, err := v.ConvertToDouble()
+		return NewDoubleValue(x), err
+	}
+
+	x, err := v.ConvertToBigDecimal()
+	return NewBigDecimalValue(x), err
+}
+
+func (v Value) ConvertToInteger() (int32, error) {
+	switch v.Type {
+	case CharValue, ShortValue, IntegerValue:
+		return int32(v.i), nil
 	}
 
 	return 0, fmt.Errorf("cannot convert Type %d into int32", v.Type)
@@ -87,14 +210,10 @@ func (v Value) ConvertToInteger() (int32, error) {
 
 func (v Value) ConvertToFloat() (float32, error) {
 	switch v.Type {
-	case CharValue:
-		return float32(v.V.(int8)), nil
-	case ShortValue:
-		return float32(v.V.(int16)), nil
-	case IntegerValue:
-		return float32(v.V.(int32)), nil
+	case CharValue, ShortValue, IntegerValue:
+		return float32(v.i), nil
 	case FloatValue:
-		return v.V.(float32), nil
+		return float32(v.f), nil
 	}
 
 	return 0, fmt.Errorf("cannot convert Type %d into float32", v.Type)
@@ -102,10 +221,8 @@ func (v Value) ConvertToFloat() (float32, error) {
 
 func (v Value) ConvertToShort() (int16, error) {
 	switch v.Type {
-	case CharValue:
-		return int16(v.V.(int8)), nil
-	case ShortValue:
-		return int16(v.V.(int16)), nil
+	case CharValue, ShortValue:
+		return int16(v.i), nil
 	}
 
 	return 0, fmt.Errorf("cannot convert Type %d into in16", v.Type)
@@ -113,16 +230,10 @@ func (v Value) ConvertToShort() (int16, error) {
 
 func (v Value) ConvertToDouble() (float64, error) {
 	switch v.Type {
-	case CharValue:
-		return float64(v.V.(int8)), nil
-	case ShortValue:
-		return float64(v.V.(int16)), nil
-	case IntegerValue:
-		return float64(v.V.(int32)), nil
-	case FloatValue:
-		return float64(v.V.(float32)), nil
-	case DoubleValue:
-		return v.V.(float64), nil
+	case CharValue, ShortValue, IntegerValue:
+		return float64(v.i), nil
+	case FloatValue, DoubleValue:
+		return v.f, nil
 	}
 
 	return 0, fmt.Errorf("cannot convert Type %d into float64", v.Type)
@@ -130,8 +241,77 @@ func (v Value) ConvertToDouble() (float64, error) {
 
 func (v Value) ConvertToChar() (int8, error) {
 	if v.Type == CharValue {
-		return v.V.(int8), nil
+		return int8(v.i), nil
 	}
 
 	return 0, fmt.Errorf("cannot convert Type %d into int8", v.Type)
 }
+
+func (v Value) ConvertToBigDecimal() (*big.Rat, error) {
+	switch v.Type {
+	case CharValue, ShortValue, IntegerValue:
+		return new(big.Rat).SetInt64(v.i), nil
+	case FloatValue:
+		// go through the shortest decimal representation so that float(0.1)
+		// becomes 0.1 rather than its binary approximation.
+		return parseDecimal(strconv.FormatFloat(v.f, 'g', -1, 32))
+	case DoubleValue:
+		return parseDecimal(strconv.FormatFloat(v.f, 'g', -1, 64))
+	case BigDecimalValue:
+		return new(big.Rat).Set(v.d), nil
+	}
+
+	return nil, fmt.Errorf("cannot convert Type %d into bigdecimal", v.Type)
+}
+
+func parseDecimal(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %s into bigdecimal", s)
+	}
+
+	return r, nil
+}
+
+// formatDecimal returns the decimal representation of r. It is exact when r
+// has a finite decimal expansion, otherwise r is rounded to decimalPrecision
+// fractional digits.
+func formatDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// a fraction has a finite decimal expansion only if its denominator is of
+	// the form 2^n * 5^m, in which case max(n, m) digits are enough.
+	d := new(big.Int).Set(r.Denom())
+	twos := removeFactor(d, 2)
+	fives := removeFactor(d, 5)
+	if !d.IsInt64() || d.Int64() != 1 {
+		s := r.FloatString(decimalPrecision)
+		return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	prec := twos
+	if fives > prec {
+		prec = fives
+	}
+
+	return r.FloatString(prec)
+}
+
+// removeFactor divides d by f as many times as possible and returns the number
+// of divisions.
+func removeFactor(d *big.Int, f int64) int {
+	n := 0
+	q, m := new(big.Int), new(big.Int)
+	bf := big.NewInt(f)
+	for {
+		q.QuoRem(d, bf, m)
+		if m.Sign() != 0 {
+			return n
+		}
+
+		d.Set(q)
+		n++
+	}
+}
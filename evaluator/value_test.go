@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"github.com/stretchr/testify/require"
+	"math/big"
 	"testing"
 )
 
@@ -16,9 +17,42 @@ func TestGetBiggerType(t *testing.T) {
 		{NewInt16Value(1), NewInt32Value(1), IntegerValue},
 		{NewInt16Value(1), NewFloatValue(1), FloatValue},
 		{NewFloatValue(14.5), NewDoubleValue(42.42), DoubleValue},
+		{NewBigDecimalValue(big.NewRat(1, 2)), NewDoubleValue(42.42), BigDecimalValue},
+		{NewInt32Value(1), NewInt8Value(1), IntegerValue},
 	}
 
 	for _, tt := range tests {
 		require.Equal(t, GetBiggerType(tt.a, tt.b), tt.want)
 	}
 }
+
+func TestPromote(t *testing.T) {
+	tests := []struct {
+		v     Value
+		to    ValueType
+		want  string
+		fails bool
+	}{
+		{NewInt8Value(-5), ShortValue, "{-5 int16}", false},
+		{NewInt8Value(-5), IntegerValue, "{-5 int32}", false},
+		{NewInt16Value(300), FloatValue, "{300 float}", false},
+		{NewInt32Value(7), DoubleValue, "{7 double}", false},
+		{NewFloatValue(0.5), DoubleValue, "{0.5 double}", false},
+		{NewDoubleValue(0.1), BigDecimalValue, "{0.1 bigdecimal}", false},
+		{NewInt32Value(300), ShortValue, "", true},
+		{NewDoubleValue(1), FloatValue, "", true},
+		{NewBigDecimalValue(big.NewRat(1, 1)), IntegerValue, "", true},
+	}
+
+	for _, tt := range tests {
+		v, err := tt.v.Promote(tt.to)
+		if tt.fails {
+			require.Error(t, err)
+			continue
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, tt.to, v.Type)
+		require.Equal(t, tt.want, v.String())
+	}
+}
@@ -0,0 +1,466 @@
+package evaluator
+
+import (
+	"avm/ast"
+	"avm/token"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrExit is returned by Eval when an exit instruction is reached.
+// Callers should stop evaluating instructions and treat it as a clean end of
+// the program.
+var ErrExit = errors.New("exit")
+
+// ErrUndefinedVariable is returned by load when the variable was never
+// stored.
+var ErrUndefinedVariable = errors.New("undefined variable")
+
+// ErrInstructionLimit is returned by Eval when a program executes more
+// instructions than allowed by VM.MaxInstructions.
+var ErrInstructionLimit = errors.New("error: instruction limit exceeded")
+
+// VM evaluates instructions on a stack. Everything the instructions display
+// is written to Stdout.
+type VM struct {
+	Stack  *Stack
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Mode defines how results that do not fit in their type are handled.
+	Mode ArithmeticMode
+
+	// Debug traces each evaluated instruction on Stderr.
+	Debug bool
+
+	// Trace receives a TraceRecord for each instruction of a program, as
+	// JSON lines, when it is not nil.
+	Trace io.Writer
+
+	// Profile collects the number of executions and the time of each
+	// instruction when it is not nil.
+	Profile *Profile
+
+	// MaxInstructions is the number of instructions a program can execute,
+	// 0 means unlimited.
+	MaxInstructions int
+
+	// Timeout is the wall-clock time a program can run for, 0 means
+	// unlimited.
+	Timeout time.Duration
+
+	// MaxCallDepth is the number of nested calls allowed, 0 means
+	// unlimited.
+	MaxCallDepth int
+
+	stmts   []ast.Statement // statements of the loaded program
+	pc      int             // index of the next statement of the program
+	labels  map[string]int  // index of the statement defined by each label
+	returns []int           // return stack, index of the statement following each call
+	vars    map[string]Value
+}
+
+// NewVM returns a VM evaluating instructions on st and writing to os.Stdout
+// and os.Stderr, which allows DefaultMaxCallDepth nested calls.
+func NewVM(st *Stack) *VM {
+	return &VM{Stack: st, Stdout: os.Stdout, Stderr: os.Stderr, MaxCallDepth: DefaultMaxCallDepth}
+}
+
+// Reset empties the stack and forgets every variable.
+func (vm *VM) Reset() {
+	vm.Stack.Clear()
+	vm.vars = nil
+}
+
+func (vm *VM) Eval(node ast.Node) (Value, error) {
+	return vm.EvalContext(context.Background(), node)
+}
+
+// EvalContext evaluates node like Eval. A program is stopped with a HaltError
+// when ctx is done, or when it exceeds MaxInstructions or Timeout.
+func (vm *VM) EvalContext(ctx context.Context, node ast.Node) (Value, error) {
+	pg, ok := node.(*ast.Program)
+	if !ok {
+		return vm.eval(node)
+	}
+
+	if vm.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vm.Timeout)
+		defer cancel()
+	}
+
+	return vm.evalStatements(ctx, pg.Statements)
+}
+
+func (vm *VM) eval(node ast.Node) (Value, error) {
+	switch n := node.(type) {
+	case *ast.PushStatement:
+		return vm.evalPushStatement(n)
+	case *ast.AddStatement:
+		return vm.evalBinary(addOp)
+	case *ast.AssertStatement:
+		return vm.evalAssert(n)
+	case *ast.MulStatement:
+		return vm.evalBinary(mulOp)
+	case *ast.DivStatement:
+		return vm.evalBinary(divOp)
+	case *ast.ModStatement:
+		return vm.evalBinary(modOp)
+	case *ast.DumpStatement:
+		return Value{}, vm.Stack.Dump(vm.Stdout)
+	case *ast.PopStatement:
+		return vm.Stack.Pop()
+	case *ast.SubStatement:
+		return vm.evalBinary(subOp)
+	case *ast.ClearStatement:
+		vm.Stack.Clear()
+		return Value{}, nil
+	case *ast.DupStatement:
+		return vm.evalDup()
+	case *ast.SwapStatement:
+		return vm.evalSwap()
+	case *ast.PrintStatement:
+		return vm.evalPrint()
+	case *ast.LabelStatement:
+		return Value{}, nil
+	case *ast.JumpStatement:
+		return vm.evalJump(n)
+	case *ast.StoreStatement:
+		return vm.evalStore(n.Variable.Value)
+	case *ast.LoadStatement:
+		return vm.evalLoad(n.Variable.Value)
+	case *ast.CallStatement:
+		return vm.evalCall(n)
+	case *ast.RetStatement:
+		return vm.evalRet()
+	case *ast.CompareStatement:
+		return vm.evalCompare(n.Token.Type)
+	case *ast.StackStatement:
+		var count int
+		if n.Count != nil {
+			count = int(n.Count.IntValue)
+		}
+		return vm.evalStack(n.Token.Type, count)
+	case *ast.CastStatement:
+		return vm.evalCast(n)
+	case *ast.MathStatement:
+		return vm.evalMath(n.Token.Type)
+	case *ast.BitwiseStatement:
+		return vm.evalBitwise(n.Token.Type)
+	case *ast.ExitStatement:
+		return Value{}, ErrExit
+	case *ast.ExpressionStatement:
+		return vm.eval(n.Expression)
+	case *ast.IntegerLiteral:
+		return NewInt32Value(n.IntValue), nil
+	case *ast.InfixExpression:
+		left, err := vm.eval(n.Left)
+		if err != nil {
+			return Value{}, err
+		}
+		right, err := vm.eval(n.Right)
+		if err != nil {
+			return Value{}, err
+		}
+		return vm.evalInfixExpression(n.Operator, left, right)
+	default:
+		return Value{}, fmt.Errorf("unknown instruction ")
+	}
+
+}
+
+func (vm *VM) evalInfixExpression(op string, left, right Value) (Value, error) {
+	bop, ok := infixOps[op]
+	if !ok {
+		return Value{}, fmt.Errorf("no infix evaluator for %q", op)
+	}
+
+	return vm.applyBinary(bop, left, right)
+}
+
+// evalStatements evaluates the statements from the first one, in order
+// unless a jump moves the program counter, and returns the value of the last
+// one. It stops at the first error, which is returned as a *RuntimeError.
+func (vm *VM) evalStatements(ctx context.Context, stmts []ast.Statement) (Value, error) {
+	if err := vm.load(stmts); err != nil {
+		return Value{}, err
+	}
+
+	var v Value
+	for executed := 0; !vm.Done(); executed++ {
+		stmt := vm.Next()
+		if err := ctx.Err(); err != nil {
+			return v, &HaltError{Pos: stmt.Pos(), Executed: executed, Err: err}
+		}
+
+		if vm.MaxInstructions > 0 && executed >= vm.MaxInstructions {
+			return v, &HaltError{Pos: stmt.Pos(), Executed: executed, Err: ErrInstructionLimit}
+		}
+
+		var err error
+		if v, err = vm.Step(); err != nil {
+			return v, err
+		}
+	}
+
+	return v, nil
+}
+
+// Load prepares pg to be executed one statement at a time with Step, from
+// its first statement. The stack and the variables are kept.
+func (vm *VM) Load(pg *ast.Program) error {
+	return vm.load(pg.Statements)
+}
+
+func (vm *VM) load(stmts []ast.Statement) error {
+	labels, err := ResolveLabels(stmts)
+	if err != nil {
+		return err
+	}
+
+	vm.stmts = stmts
+	vm.labels = labels
+	vm.pc = 0
+	vm.returns = vm.returns[:0]
+	vm.skipLabels()
+	return nil
+}
+
+// skipLabels moves the program counter past the labels, which are not
+// instructions: they are neither executed, counted, traced nor profiled.
+func (vm *VM) skipLabels() {
+	for !vm.Done() {
+		if _, ok := vm.stmts[vm.pc].(*ast.LabelStatement); !ok {
+			return
+		}
+		vm.pc++
+	}
+}
+
+// Done reports whether the loaded program has no statement left to execute.
+func (vm *VM) Done() bool {
+	return vm.pc >= len(vm.stmts)
+}
+
+// Next returns the statement executed by the next call to Step, or nil when
+// the program is done.
+func (vm *VM) Next() ast.Statement {
+	if vm.Done() {
+		return nil
+	}
+
+	return vm.stmts[vm.pc]
+}
+
+// Calls returns the positions of the calls which have not returned yet, from
+// the most recent one.
+func (vm *VM) Calls() []token.Position {
+	calls := make([]token.Position, 0, len(vm.returns))
+	for i := len(vm.returns) - 1; i >= 0; i-- {
+		calls = append(calls, vm.stmts[vm.returns[i]-1].Pos())
+	}
+
+	return calls
+}
+
+// Step executes the next statement of the loaded program and returns its
+// value. An error is returned as a *RuntimeError, except ErrExit which is
+// returned as is.
+func (vm *VM) Step() (Value, error) {
+	if vm.Done() {
+		return Value{}, errors.New("error: no instruction left to execute")
+	}
+
+	stmt := vm.stmts[vm.pc]
+	vm.pc++
+	depth := vm.Stack.Size()
+	if vm.Debug {
+		// checked here so that the arguments are not boxed for nothing
+		vm.debugf("%s: %s (stack depth %d)", stmt.Pos(), stmt, depth)
+	}
+
+	var before *TraceValue
+	if vm.Trace != nil {
+		before = vm.top()
+	}
+
+	var start time.Time
+	if vm.Profile != nil {
+		start = time.Now()
+	}
+
+	v, err := vm.eval(stmt)
+	vm.skipLabels()
+	if vm.Profile != nil {
+		vm.Profile.record(stmt.Pos(), stmt.TokenLiteral(), stmt.String(), start, time.Since(start), vm.Stack.Size())
+	}
+
+	if vm.Trace != nil {
+		vm.trace(stmt.Pos(), stmt.String(), before, err)
+	}
+
+	if err == nil || err == ErrExit {
+		return v, err
+	}
+
+	return v, &RuntimeError{Pos: stmt.Pos(), Instruction: stmt.String(), Depth: depth, Err: err}
+}
+
+// debugf writes a trace line on Stderr when debugging is enabled.
+func (vm *VM) debugf(format string, args ...interface{}) {
+	if !vm.Debug {
+		return
+	}
+
+	_, _ = fmt.Fprintf(vm.Stderr, "debug: "+format+"\n", args...)
+}
+
+func convertAstToValue(n string, expr ast.Expression) (Value, error) {
+	switch {
+	case n == token.INT32:
+		value := expr.(*ast.IntegerLiteral)
+		v := NewInt32Value(value.IntValue)
+		return v, nil
+	case n == token.INT8:
+		value := expr.(*ast.ByteLiteral)
+		v := NewInt8Value(value.ByteValue)
+		return v, nil
+	case n == token.INT16:
+		value := expr.(*ast.ShortLiteral)
+		v := NewInt16Value(value.ShortValue)
+		return v, nil
+	case n == token.FLOAT:
+		value := expr.(*ast.FloatLiteral)
+		v := NewFloatValue(value.FloatValue)
+		return v, nil
+	case n == token.DOUBLE:
+		value := expr.(*ast.DoubleLiteral)
+		v := NewDoubleValue(value.DoubleValue)
+		return v, nil
+	case n == token.BIGDECIMAL:
+		value := expr.(*ast.BigDecimalLiteral)
+		v := NewBigDecimalValue(value.DecimalValue)
+		return v, nil
+	}
+
+	return Value{}, fmt.Errorf("bad statement %s", n)
+}
+
+// EvalOperand returns the value given between parentheses to push and assert.
+func (vm *VM) EvalOperand(name string, expr ast.Expression) (Value, error) {
+	if _, ok := expr.(*ast.InfixExpression); ok {
+		return vm.eval(expr)
+	}
+
+	return convertAstToValue(name, expr)
+}
+
+func (vm *VM) evalPushStatement(stmt *ast.PushStatement) (Value, error) {
+	v, err := vm.EvalOperand(stmt.Name.String(), stmt.Value)
+	if err != nil {
+		return Value{}, err
+	}
+
+	return vm.push(v)
+}
+
+func (vm *VM) push(v Value) (Value, error) {
+	if err := vm.Stack.Push(v); err != nil {
+		return Value{}, err
+	}
+
+	return v, nil
+}
+
+func (vm *VM) evalAssert(stmt *ast.AssertStatement) (Value, error) {
+	v, err := vm.EvalOperand(stmt.Name.String(), stmt.Value)
+	if err != nil {
+		return Value{}, err
+	}
+
+	return vm.assert(v)
+}
+
+// assert checks that the value at the top of the stack is equal to v.
+func (vm *VM) assert(v Value) (Value, error) {
+	if vm.Stack.IsEmpty() {
+		return Value{}, errors.New("cannot check value empty stack")
+	}
+
+	res, _ := vm.Stack.Peek(0)
+
+	if res.Equal(v) {
+		return v, nil
+	}
+
+	if v.Type == BigDecimalValue && res.Type == BigDecimalValue {
+		return v, fmt.Errorf("expected %s stack contains %s", v, res)
+	}
+
+	return v, fmt.Errorf("expected %s(%s) stack contains  %s(%s)", v.Type, v.Literal(), res.Type, res.Literal())
+}
+
+// evalStore pops the value at the top of the stack into a variable. Variables
+// keep their value from one program to the next until Reset.
+func (vm *VM) evalStore(name string) (Value, error) {
+	v, err := vm.Stack.Pop()
+	if err != nil {
+		return Value{}, errors.New("error: store on empty stack")
+	}
+
+	if vm.vars == nil {
+		vm.vars = make(map[string]Value)
+	}
+
+	vm.vars[name] = v
+	return v, nil
+}
+
+func (vm *VM) evalLoad(name string) (Value, error) {
+	v, ok := vm.vars[name]
+	if !ok {
+		return Value{}, fmt.Errorf("error: %w %q", ErrUndefinedVariable, name)
+	}
+
+	if err := vm.Stack.Push(v); err != nil {
+		return Value{}, err
+	}
+
+	return v, nil
+}
+
+func (vm *VM) evalDup() (Value, error) {
+	if err := vm.Stack.Dup(); err != nil {
+		return Value{}, err
+	}
+
+	return vm.Stack.Peek(0)
+}
+
+func (vm *VM) evalSwap() (Value, error) {
+	if err := vm.Stack.Swap(); err != nil {
+		return Value{}, err
+	}
+
+	return vm.Stack.Peek(0)
+}
+
+// evalPrint displays the int8 value at the top of the stack as an ASCII char.
+func (vm *VM) evalPrint() (Value, error) {
+	if vm.Stack.IsEmpty() {
+		return Value{}, errors.New("error: print on empty stack")
+	}
+
+	v, _ := vm.Stack.Peek(0)
+	if v.Type != CharValue {
+		return v, fmt.Errorf("error: print expects %s on top of the stack: got %s", CharValue, v.Type)
+	}
+
+	_, err := vm.Stdout.Write([]byte{byte(v.i)})
+	return v, err
+}
@@ -6,20 +6,34 @@ import (
 )
 
 type Lexer struct {
-	in      string
-	Pos     int // current position (points to current char)
-	readPos int // current reading position in input. Always point to the next char in the input
-	ch      byte
+	in       string
+	filename string
+	Pos      int // current position (points to current char)
+	readPos  int // current reading position in input. Always point to the next char in the input
+	ch       byte
+	line     int // line of the current char
+	col      int // column of the current char
 }
 
 func New(in string) *Lexer {
-	l := &Lexer{in: in}
+	return NewFile("", in)
+}
+
+// NewFile returns a Lexer whose token positions refer to filename.
+func NewFile(filename, in string) *Lexer {
+	l := &Lexer{in: in, filename: filename, line: 1}
 	l.scan()
 	return l
 }
 
 // scan find the next char
 func (l *Lexer) scan() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
+	l.col++
+
 	if l.readPos >= len(l.in) {
 		l.ch = 0
 	} else {
@@ -35,8 +49,18 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.scanIgnoreWhiteSpace()
+	pos := token.Position{Filename: l.filename, Line: l.line, Column: l.col}
 
 	switch l.ch {
+	case '\n':
+		// consecutive newlines are a single instruction separator
+		for l.ch == '\n' {
+			l.scan()
+			l.scanIgnoreWhiteSpace()
+		}
+		return token.Token{Type: token.LF, Literal: token.LF, Pos: pos}
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -65,6 +89,7 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.ScanIdent()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.scanNumber()
@@ -73,6 +98,7 @@ func (l *Lexer) NextToken() token.Token {
 			} else {
 				tok.Type = token.INT
 			}
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -81,6 +107,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.scan()
+	tok.Pos = pos
 	return tok
 
 }
@@ -127,11 +154,11 @@ func isDigit(ch byte) bool {
 
 // newToken return a new Token
 func newToken(tokenType token.TokenType, ch byte) token.Token {
-	return token.Token{tokenType, string(ch)}
+	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func (l *Lexer) scanIgnoreWhiteSpace() {
-	for l.ch == ' ' || l.ch == '\r' || l.ch == '\t' || l.ch == '\n' {
+	for l.ch == ' ' || l.ch == '\r' || l.ch == '\t' {
 		l.scan()
 	}
 
@@ -40,6 +40,9 @@ func TestNextToken(t *testing.T) {
 		{
 			token.RPAREN, ")",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.PUSH, "push",
 		},
@@ -55,9 +58,15 @@ func TestNextToken(t *testing.T) {
 		{
 			token.RPAREN, ")",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.ADD, "add",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.PUSH, "push",
 		},
@@ -73,10 +82,15 @@ func TestNextToken(t *testing.T) {
 		{
 			token.RPAREN, ")",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.MUL, "mul",
 		},
-
+		{
+			token.LF, "\n",
+		},
 		{
 			token.PUSH, "push",
 		},
@@ -92,6 +106,9 @@ func TestNextToken(t *testing.T) {
 		{
 			token.RPAREN, ")",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.PUSH, "push",
 		},
@@ -107,12 +124,21 @@ func TestNextToken(t *testing.T) {
 		{
 			token.RPAREN, ")",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.DUMP, "dump",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.POP, "pop",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.ASSERT, "assert",
 		},
@@ -128,9 +154,15 @@ func TestNextToken(t *testing.T) {
 		{
 			token.RPAREN, ")",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.EXIT, "exit",
 		},
+		{
+			token.LF, "\n",
+		},
 		{
 			token.EOI, ";;",
 		},
@@ -148,3 +180,53 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := "push int8(5)\n\n  ; comment\n\tpop"
+
+	tests := []struct {
+		expectedType token.TokenType
+		line         int
+		column       int
+	}{
+		{token.PUSH, 1, 1},
+		{token.INT8, 1, 6},
+		{token.LPAREN, 1, 10},
+		{token.INT, 1, 11},
+		{token.RPAREN, 1, 12},
+		{token.LF, 1, 13},
+		{token.SEMICOLON, 3, 3},
+		{token.IDENT, 3, 5},
+		{token.LF, 3, 12},
+		{token.POP, 4, 2},
+		{token.EOF, 4, 5},
+	}
+
+	l := New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		require.Equal(t, tt.expectedType, tok.Type)
+		require.Equal(t, token.Position{Line: tt.line, Column: tt.column}, tok.Pos)
+	}
+}
+
+func TestLabelTokens(t *testing.T) {
+	l := New("loop: jnz loop")
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "loop"},
+		{token.COLON, ":"},
+		{token.JNZ, "jnz"},
+		{token.IDENT, "loop"},
+		{token.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+		require.Equal(t, tt.expectedType, tok.Type)
+		require.Equal(t, tt.expectedLiteral, tok.Literal)
+	}
+}
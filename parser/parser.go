@@ -5,7 +5,9 @@ import (
 	"avm/lexer"
 	"avm/token"
 	"fmt"
-	"os"
+	"io"
+	"io/ioutil"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -59,9 +61,9 @@ type (
 // Error returns the string representation of the error.
 func (e *ParseError) Error() string {
 	if e.Message != "" {
-		return fmt.Sprintf("%s at char %d", e.Message, e.Pos)
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
 	}
-	return fmt.Sprintf("found %s, expected %s at char %d", e.Found, strings.Join(e.Expected, ", "), e.Pos)
+	return fmt.Sprintf("%s: found %s, expected %s", e.Pos, e.Found, strings.Join(e.Expected, ", "))
 }
 
 func LookupOperand(op string) token.TokenType {
@@ -76,10 +78,10 @@ type ParseError struct {
 	Message  string
 	Found    string
 	Expected []string
-	Pos      int
+	Pos      token.Position
 }
 
-func newParseError(found string, expected []string, pos int) *ParseError {
+func newParseError(found string, expected []string, pos token.Position) *ParseError {
 	return &ParseError{Found: found,
 		Expected: expected,
 		Pos:      pos,
@@ -97,7 +99,10 @@ type Parser struct {
 
 // NewParser returns a new instance of Parser.
 func NewParser(in string) *Parser {
-	l := lexer.New(in)
+	return newParser(lexer.New(in))
+}
+
+func newParser(l *lexer.Lexer) *Parser {
 	p := &Parser{l: l}
 	p.nextToken()
 	p.nextToken()
@@ -108,6 +113,7 @@ func NewParser(in string) *Parser {
 	p.registerPrefix(token.INT32, p.parseIntegerLiteral)
 	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.DOUBLE, p.parseDoubleLiteral)
+	p.registerPrefix(token.BIGDECIMAL, p.parseBigDecimalLiteral)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
@@ -122,10 +128,6 @@ func NewParser(in string) *Parser {
 	return p
 }
 
-func (p *Parser) parseExit() {
-	os.Exit(0)
-}
-
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -155,20 +157,43 @@ func (p Parser) curPrecedence() int {
 	return LOWEST
 }
 
-// ParseInstruction returns an instance of ast.Program
-func (p *Parser) ParseInstruction() (*ast.Program, error) {
+// NewParserFromReader returns a new instance of Parser reading the whole
+// source from r.
+func NewParserFromReader(r io.Reader) (*Parser, error) {
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewParser(string(in)), nil
+}
+
+// ParseFile parses the whole content of filename. Positions of the returned
+// statements refer to filename.
+func ParseFile(filename string) (*ast.Program, error) {
+	in, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return newParser(lexer.NewFile(filename, string(in))).ParseProgram()
+}
+
+// ParseProgram parses the whole source and returns an instance of ast.Program
+// holding every instruction in order. Instructions are separated by newlines
+// and a ';' starts a comment running until the end of the line.
+func (p *Parser) ParseProgram() (*ast.Program, error) {
 	var pg ast.Program
 
 	pg.Statements = []ast.Statement{}
 	for p.curTok.Type != token.EOF {
-
-		if p.curTok.Type == token.EXIT || p.curTok.Type == token.EOI {
-			p.parseExit()
-		}
-
-		if p.curTok.Type == token.SEMICOLON {
+		switch p.curTok.Type {
+		case token.LF:
+			p.nextToken()
+			continue
+		case token.SEMICOLON:
 			_, _ = p.parseCommentStatement()
-			return nil, nil
+			continue
 		}
 
 		stmt, err := p.parseStatement()
@@ -180,12 +205,39 @@ func (p *Parser) ParseInstruction() (*ast.Program, error) {
 			pg.Statements = append(pg.Statements, stmt)
 		}
 
-		p.nextToken()
+		// an instruction can follow a label on the same line
+		if _, ok := stmt.(*ast.LabelStatement); ok {
+			continue
+		}
+
+		// instructions taking a value stop on their last token
+		if !p.endOfInstruction() {
+			p.nextToken()
+		}
+
+		if !p.endOfInstruction() {
+			return nil, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+		}
 	}
 
 	return &pg, nil
 }
 
+// ParseInstruction parses a single line of input. It returns nil when the
+// line holds no instruction.
+func (p *Parser) ParseInstruction() (*ast.Program, error) {
+	pg, err := p.ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pg.Statements) == 0 {
+		return nil, nil
+	}
+
+	return pg, nil
+}
+
 func (p *Parser) parseStatement() (ast.Statement, error) {
 	switch p.curTok.Type {
 	case token.PUSH:
@@ -206,6 +258,41 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 		return p.parseModStatement()
 	case token.DUMP:
 		return p.parseDumpStatement()
+	case token.SUB:
+		return p.parseSubStatement()
+	case token.CLEAR:
+		return p.parseClearStatement()
+	case token.DUP:
+		return p.parseDupStatement()
+	case token.SWAP:
+		return p.parseSwapStatement()
+	case token.PRINT:
+		return p.parsePrintStatement()
+	case token.EXIT, token.EOI:
+		return p.parseExitStatement()
+	case token.JMP, token.JZ, token.JNZ, token.JLT, token.JGT:
+		return p.parseJumpStatement()
+	case token.STORE, token.LOAD:
+		return p.parseVariableStatement()
+	case token.CALL:
+		return p.parseCallStatement()
+	case token.RET:
+		return p.parseRetStatement()
+	case token.CMPEQ, token.CMPNEQ, token.CMPLT, token.CMPLE, token.CMPGT, token.CMPGE:
+		return p.parseCompareStatement()
+	case token.OVER, token.ROT, token.PICK, token.ROLL, token.DROP, token.DEPTH:
+		return p.parseStackStatement()
+	case token.CAST:
+		return p.parseCastStatement()
+	case token.NEG, token.ABS, token.MIN, token.MAX, token.POW, token.SQRT, token.EXP, token.LOG, token.SIN, token.COS:
+		return p.parseMathStatement()
+	case token.AND, token.OR, token.XOR, token.NOT, token.SHL, token.SHR, token.SAR:
+		return p.parseBitwiseStatement()
+	case token.IDENT:
+		if p.peekTokenIs(token.COLON) {
+			return p.parseLabelStatement()
+		}
+		return p.parseExpressionStatement()
 	case token.ASTERISK, token.PLUS, token.SLASH, token.MINUS:
 		return p.parseExpressionStatement()
 	default:
@@ -218,6 +305,17 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 
 }
 
+// endOfInstruction reports whether the current token terminates an
+// instruction.
+func (p *Parser) endOfInstruction() bool {
+	switch p.curTok.Type {
+	case token.EOF, token.LF, token.SEMICOLON:
+		return true
+	}
+
+	return false
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curTok.Type == t
 }
@@ -258,7 +356,7 @@ func (p *Parser) parseGroupedExpression() (ast.Expression, error) {
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return exp, newParseError(p.curTok.Literal, []string{"token ')'"}, p.l.Pos)
+		return exp, newParseError(p.curTok.Literal, []string{"token ')'"}, p.curTok.Pos)
 	}
 
 	return exp, nil
@@ -267,7 +365,7 @@ func (p *Parser) parseGroupedExpression() (ast.Expression, error) {
 func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
 	prefix := p.prefixParseFns[p.curTok.Type]
 	if prefix == nil {
-		return nil, newParseError(p.curTok.Literal, []string{"identifier"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"identifier"}, p.curTok.Pos)
 	}
 
 	leftExpr, err := prefix()
@@ -309,7 +407,6 @@ func (p *Parser) parsePrefixExpression() (ast.Expression, error) {
 
 func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, error) {
 	var err error
-	fmt.Printf("%T::: \n", left)
 	expr := &ast.InfixExpression{
 		Token:    p.curTok,
 		Operator: p.curTok.Literal,
@@ -332,7 +429,7 @@ func (p *Parser) parseInstructionStatement() (*ast.InstructionStatement, error)
 	stmt := &ast.InstructionStatement{Token: p.curTok}
 
 	if !token.IsIdent(p.curTok.Literal) {
-		return nil, newParseError(p.curTok.Literal, []string{"instruction"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"instruction"}, p.curTok.Pos)
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
@@ -345,25 +442,43 @@ func (p *Parser) parsePushStatement() (*ast.PushStatement, error) {
 	operand := LookupOperand(p.curTok.Literal)
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	if !p.expectPeek(token.LPAREN) {
-		return nil, newParseError(p.curTok.Literal, []string{"value"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"value"}, p.curTok.Pos)
 	}
 
 	p.nextToken()
-	p.curTok.Type = operand
-	stmt.Value, _ = p.parseExpression(LOWEST)
+	var err error
+	stmt.Value, err = p.parseOperandValue(operand)
+	if err != nil {
+		return nil, err
+	}
+
 	if !p.expectPeek(token.RPAREN) {
-		return nil, newParseError(p.curTok.Literal, []string{"token ')'"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"token ')'"}, p.curTok.Pos)
 	}
 
-	fmt.Printf("return stmt: %v\n", stmt)
 	return stmt, nil
 }
 
+// parseOperandValue parses the value given between parentheses to an
+// instruction, e.g. 42 in push int8(42). A leading minus sign is part of the
+// literal so that the lowest value of each type can be written.
+func (p *Parser) parseOperandValue(operand token.TokenType) (ast.Expression, error) {
+	if p.curTokenIs(token.MINUS) && (p.peekTokenIs(token.INT) || p.peekTokenIs(token.FLOAT_NUM)) {
+		pos := p.curTok.Pos
+		p.nextToken()
+		p.curTok.Literal = token.MINUS + p.curTok.Literal
+		p.curTok.Pos = pos
+	}
+
+	p.curTok.Type = operand
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseIntegerLiteral() (ast.Expression, error) {
 	lit := &ast.IntegerLiteral{Token: p.curTok}
 	value, err := strconv.ParseInt(p.curTok.Literal, 0, 32)
 	if err != nil {
-		return nil, newParseError(p.curTok.Literal, []string{"identifier"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"identifier"}, p.curTok.Pos)
 	}
 
 	lit.IntValue = int32(value)
@@ -374,7 +489,7 @@ func (p *Parser) parseShortValueLiteral() (ast.Expression, error) {
 	lit := &ast.ShortLiteral{Token: p.curTok}
 	value, err := strconv.ParseInt(p.curTok.Literal, 0, 16)
 	if err != nil {
-		return nil, newParseError(p.curTok.Literal, []string{"identifier"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"identifier"}, p.curTok.Pos)
 	}
 
 	lit.ShortValue = int16(value)
@@ -385,7 +500,7 @@ func (p *Parser) parseByteValueLiteral() (ast.Expression, error) {
 	lit := &ast.ByteLiteral{Token: p.curTok}
 	value, err := strconv.ParseInt(p.curTok.Literal, 0, 8)
 	if err != nil {
-		return nil, newParseError(fmt.Sprintf("expected %s", token.INT8), []string{"value"}, p.l.Pos)
+		return nil, newParseError(fmt.Sprintf("expected %s", token.INT8), []string{"value"}, p.curTok.Pos)
 	}
 
 	lit.ByteValue = int8(value)
@@ -398,7 +513,7 @@ func (p *Parser) parseFloatLiteral() (ast.Expression, error) {
 	p.curTok.Type = token.FLOAT32
 	value, err := strconv.ParseFloat(p.curTok.Literal, 32)
 	if err != nil {
-		return nil, newParseError(fmt.Sprintf("%s", token.INT8), []string{"value"}, p.l.Pos)
+		return nil, newParseError(fmt.Sprintf("%s", token.INT8), []string{"value"}, p.curTok.Pos)
 	}
 
 	lit.FloatValue = float32(value)
@@ -411,13 +526,25 @@ func (p *Parser) parseDoubleLiteral() (ast.Expression, error) {
 	p.curTok.Type = token.FLOAT64
 	value, err := strconv.ParseFloat(p.curTok.Literal, 64)
 	if err != nil {
-		return nil, newParseError(fmt.Sprintf("%s", p.curTok.Literal), []string{"value"}, p.l.Pos)
+		return nil, newParseError(fmt.Sprintf("%s", p.curTok.Literal), []string{"value"}, p.curTok.Pos)
 	}
 
 	lit.DoubleValue = value
 	return lit, nil
 }
 
+func (p *Parser) parseBigDecimalLiteral() (ast.Expression, error) {
+	lit := &ast.BigDecimalLiteral{Token: p.curTok}
+
+	value, ok := new(big.Rat).SetString(p.curTok.Literal)
+	if !ok {
+		return nil, newParseError(p.curTok.Literal, []string{"value"}, p.curTok.Pos)
+	}
+
+	lit.DecimalValue = value
+	return lit, nil
+}
+
 func (p *Parser) parseValueLiteral() ast.Expression {
 	lit := &ast.ValueLiteral{Token: p.curTok}
 
@@ -453,14 +580,18 @@ func (p *Parser) parseAssertStatement() (*ast.AssertStatement, error) {
 	operand := LookupOperand(p.curTok.Literal)
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	if !p.expectPeek(token.LPAREN) {
-		return nil, newParseError(p.curTok.Literal, []string{"value"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"value"}, p.curTok.Pos)
 	}
 
 	p.nextToken()
-	p.curTok.Type = operand
-	stmt.Value, _ = p.parseExpression(LOWEST)
+	var err error
+	stmt.Value, err = p.parseOperandValue(operand)
+	if err != nil {
+		return nil, err
+	}
+
 	if !p.expectPeek(token.RPAREN) {
-		return nil, newParseError(p.curTok.Literal, []string{"token ')'"}, p.l.Pos)
+		return nil, newParseError(p.curTok.Literal, []string{"token ')'"}, p.curTok.Pos)
 	}
 
 	return stmt, nil
@@ -468,11 +599,10 @@ func (p *Parser) parseAssertStatement() (*ast.AssertStatement, error) {
 
 func (p *Parser) parseAddStatement() (*ast.AddStatement, error) {
 	stmt := &ast.AddStatement{Token: p.curTok}
-
-	p.nextToken()
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
-	if p.curTok.Literal != "" {
-		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.l.Pos)
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
 	}
 	return stmt, nil
 }
@@ -493,8 +623,8 @@ func (p *Parser) parsePopStatement() (*ast.PopStatement, error) {
 	stmt := &ast.PopStatement{Token: p.curTok}
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	p.nextToken()
-	if p.curTok.Literal != "" {
-		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.l.Pos)
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
 	}
 
 	return stmt, nil
@@ -504,8 +634,8 @@ func (p *Parser) parseDivStatement() (*ast.DivStatement, error) {
 	stmt := &ast.DivStatement{Token: p.curTok}
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	p.nextToken()
-	if p.curTok.Literal != "" {
-		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.l.Pos)
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
 	}
 
 	return stmt, nil
@@ -515,8 +645,8 @@ func (p *Parser) parseMulStatement() (*ast.MulStatement, error) {
 	stmt := &ast.MulStatement{Token: p.curTok}
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	p.nextToken()
-	if p.curTok.Literal != "" {
-		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.l.Pos)
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
 	}
 
 	return stmt, nil
@@ -526,8 +656,8 @@ func (p *Parser) parseModStatement() (*ast.ModStatement, error) {
 	stmt := &ast.ModStatement{Token: p.curTok}
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	p.nextToken()
-	if p.curTok.Literal != "" {
-		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.l.Pos)
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
 	}
 
 	return stmt, nil
@@ -537,8 +667,225 @@ func (p *Parser) parseDumpStatement() (*ast.DumpStatement, error) {
 	stmt := &ast.DumpStatement{Token: p.curTok}
 	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
 	p.nextToken()
-	if p.curTok.Literal != "" {
-		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.l.Pos)
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseSubStatement() (*ast.SubStatement, error) {
+	stmt := &ast.SubStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseClearStatement() (*ast.ClearStatement, error) {
+	stmt := &ast.ClearStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseDupStatement() (*ast.DupStatement, error) {
+	stmt := &ast.DupStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseSwapStatement() (*ast.SwapStatement, error) {
+	stmt := &ast.SwapStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parsePrintStatement() (*ast.PrintStatement, error) {
+	stmt := &ast.PrintStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseExitStatement() (*ast.ExitStatement, error) {
+	stmt := &ast.ExitStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+// parseLabelStatement parses a label definition, e.g. loop:.
+func (p *Parser) parseLabelStatement() (*ast.LabelStatement, error) {
+	stmt := &ast.LabelStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	p.nextToken()
+
+	return stmt, nil
+}
+
+// parseJumpStatement parses a jump instruction followed by its label, e.g.
+// jnz loop.
+func (p *Parser) parseJumpStatement() (*ast.JumpStatement, error) {
+	stmt := &ast.JumpStatement{Token: p.curTok}
+	if !p.expectPeek(token.IDENT) {
+		return nil, newParseError(p.peekTok.Literal, []string{"label"}, p.peekTok.Pos)
+	}
+
+	stmt.Label = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+// parseCallStatement parses a call followed by the label of the subroutine,
+// e.g. call square.
+func (p *Parser) parseCallStatement() (*ast.CallStatement, error) {
+	stmt := &ast.CallStatement{Token: p.curTok}
+	if !p.expectPeek(token.IDENT) {
+		return nil, newParseError(p.peekTok.Literal, []string{"label"}, p.peekTok.Pos)
+	}
+
+	stmt.Label = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+// parseVariableStatement parses store or load followed by the name of a
+// variable, e.g. store counter.
+func (p *Parser) parseVariableStatement() (ast.Statement, error) {
+	tok := p.curTok
+	if !p.expectPeek(token.IDENT) {
+		return nil, newParseError(p.peekTok.Literal, []string{"variable"}, p.peekTok.Pos)
+	}
+
+	variable := &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return nil, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	if tok.Type == token.STORE {
+		return &ast.StoreStatement{Token: tok, Variable: variable}, nil
+	}
+
+	return &ast.LoadStatement{Token: tok, Variable: variable}, nil
+}
+
+func (p *Parser) parseRetStatement() (*ast.RetStatement, error) {
+	stmt := &ast.RetStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseCompareStatement() (*ast.CompareStatement, error) {
+	stmt := &ast.CompareStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+// parseStackStatement parses the stack instructions, pick, roll and drop
+// being followed by a count, e.g. pick 2.
+func (p *Parser) parseStackStatement() (*ast.StackStatement, error) {
+	stmt := &ast.StackStatement{Token: p.curTok}
+	switch stmt.Token.Type {
+	case token.PICK, token.ROLL, token.DROP:
+		if !p.expectPeek(token.INT) {
+			return nil, newParseError(p.peekTok.Literal, []string{"count"}, p.peekTok.Pos)
+		}
+
+		n, err := strconv.ParseInt(p.curTok.Literal, 10, 32)
+		if err != nil {
+			return nil, newParseError(p.curTok.Literal, []string{"count"}, p.curTok.Pos)
+		}
+
+		stmt.Count = &ast.IntegerLiteral{Token: p.curTok, IntValue: int32(n)}
+	}
+
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseCastStatement() (*ast.CastStatement, error) {
+	stmt := &ast.CastStatement{Token: p.curTok}
+	if LookupOperand(p.peekTok.Literal) == token.IDENT {
+		return nil, newParseError(p.peekTok.Literal, []string{"type"}, p.peekTok.Pos)
+	}
+
+	p.nextToken()
+	stmt.Type = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseMathStatement() (*ast.MathStatement, error) {
+	stmt := &ast.MathStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseBitwiseStatement() (*ast.BitwiseStatement, error) {
+	stmt := &ast.BitwiseStatement{Token: p.curTok}
+	stmt.Name = &ast.Identifier{Token: p.curTok, Value: p.curTok.Literal}
+	p.nextToken()
+	if !p.endOfInstruction() {
+		return stmt, newParseError(p.curTok.Literal, []string{"end of instruction"}, p.curTok.Pos)
 	}
 
 	return stmt, nil
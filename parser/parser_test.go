@@ -2,8 +2,11 @@ package parser
 
 import (
 	"avm/ast"
+	"avm/token"
 	"github.com/stretchr/testify/require"
+	"math/big"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -204,6 +207,217 @@ func TestPopStatement(t *testing.T) {
 	
 }
 
+func TestStackInstructionStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ast.Statement
+		fails bool
+	}{
+		{"sub", &ast.SubStatement{}, false},
+		{"sub pop", nil, true},
+		{"clear", &ast.ClearStatement{}, false},
+		{"clear pop", nil, true},
+		{"dup", &ast.DupStatement{}, false},
+		{"dup pop", nil, true},
+		{"swap", &ast.SwapStatement{}, false},
+		{"swap pop", nil, true},
+		{"print", &ast.PrintStatement{}, false},
+		{"print pop", nil, true},
+		{"exit", &ast.ExitStatement{}, false},
+		{"exit pop", nil, true},
+		{";;", &ast.ExitStatement{}, false},
+		{"eq", &ast.CompareStatement{}, false},
+		{"neq", &ast.CompareStatement{}, false},
+		{"lt", &ast.CompareStatement{}, false},
+		{"le", &ast.CompareStatement{}, false},
+		{"gt", &ast.CompareStatement{}, false},
+		{"ge", &ast.CompareStatement{}, false},
+		{"over", &ast.StackStatement{}, false},
+		{"rot", &ast.StackStatement{}, false},
+		{"depth", &ast.StackStatement{}, false},
+		{"neg", &ast.MathStatement{}, false},
+		{"abs", &ast.MathStatement{}, false},
+		{"min", &ast.MathStatement{}, false},
+		{"max", &ast.MathStatement{}, false},
+		{"pow", &ast.MathStatement{}, false},
+		{"sqrt", &ast.MathStatement{}, false},
+		{"exp", &ast.MathStatement{}, false},
+		{"log", &ast.MathStatement{}, false},
+		{"sin", &ast.MathStatement{}, false},
+		{"cos", &ast.MathStatement{}, false},
+		{"and", &ast.BitwiseStatement{}, false},
+		{"or", &ast.BitwiseStatement{}, false},
+		{"xor", &ast.BitwiseStatement{}, false},
+		{"not", &ast.BitwiseStatement{}, false},
+		{"shl", &ast.BitwiseStatement{}, false},
+		{"shr", &ast.BitwiseStatement{}, false},
+		{"sar", &ast.BitwiseStatement{}, false},
+		{"ge pop", nil, true},
+		{"ret", &ast.RetStatement{}, false},
+		{"ret pop", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+" statement", func(t *testing.T) {
+			p := NewParser(tt.input)
+			program, err := p.ParseInstruction()
+			if tt.fails {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, program.Statements, 1)
+			stmt := program.Statements[0]
+			require.IsType(t, tt.want, stmt)
+			require.Equal(t, tt.input, stmt.TokenLiteral())
+		})
+	}
+}
+
+func TestJumpStatements(t *testing.T) {
+	p := NewParser("loop:\n  push int8(1)\n\tjnz loop\nend: jmp end\njz loop\njlt end\njgt loop")
+	pg, err := p.ParseProgram()
+	require.NoError(t, err)
+	require.Len(t, pg.Statements, 8)
+
+	wants := []string{"loop:", "push int8(1)", "jnz loop", "end:", "jmp end", "jz loop", "jlt end", "jgt loop"}
+	for i, want := range wants {
+		require.Equal(t, want, pg.Statements[i].String())
+	}
+
+	label, ok := pg.Statements[3].(*ast.LabelStatement)
+	require.True(t, ok)
+	require.Equal(t, "end", label.Name.Value)
+	require.Equal(t, token.Position{Line: 4, Column: 1}, label.Pos())
+
+	jump, ok := pg.Statements[4].(*ast.JumpStatement)
+	require.True(t, ok)
+	require.Equal(t, token.TokenType(token.JMP), jump.Token.Type)
+	require.Equal(t, "end", jump.Label.Value)
+	require.Equal(t, token.Position{Line: 4, Column: 6}, jump.Pos())
+
+	call, err := NewParser("call square").ParseInstruction()
+	require.NoError(t, err)
+	require.IsType(t, &ast.CallStatement{}, call.Statements[0])
+	require.Equal(t, "call square", call.Statements[0].String())
+
+	vars, err := NewParser("store x\nload total2").ParseProgram()
+	require.NoError(t, err)
+	require.IsType(t, &ast.StoreStatement{}, vars.Statements[0])
+	require.Equal(t, "store x", vars.Statements[0].String())
+	require.IsType(t, &ast.LoadStatement{}, vars.Statements[1])
+	require.Equal(t, "load total2", vars.Statements[1].String())
+	require.Equal(t, token.Position{Line: 2, Column: 1}, vars.Statements[1].Pos())
+
+	for _, input := range []string{"jmp", "jmp push", "jz loop pop", "jnz 42", "call", "call f g", "store", "load pop", "store x y"} {
+		_, err := NewParser(input).ParseProgram()
+		require.Error(t, err, input)
+	}
+}
+
+func TestCountStatements(t *testing.T) {
+	pg, err := NewParser("pick 2\nroll 10\ndrop 0").ParseProgram()
+	require.NoError(t, err)
+	require.Len(t, pg.Statements, 3)
+	for i, want := range []string{"pick 2", "roll 10", "drop 0"} {
+		stmt, ok := pg.Statements[i].(*ast.StackStatement)
+		require.True(t, ok)
+		require.Equal(t, want, stmt.String())
+	}
+
+	require.Equal(t, int32(10), pg.Statements[1].(*ast.StackStatement).Count.IntValue)
+
+	for _, input := range []string{"pick", "roll -1", "drop x", "pick 1.5", "pick 2 3", "over 1", "depth 0", "drop 2147483648"} {
+		_, err := NewParser(input).ParseProgram()
+		require.Error(t, err, input)
+	}
+}
+
+func TestCastStatement(t *testing.T) {
+	pg, err := NewParser("cast int16\ncast bigdecimal").ParseProgram()
+	require.NoError(t, err)
+	require.Len(t, pg.Statements, 2)
+	cast, ok := pg.Statements[0].(*ast.CastStatement)
+	require.True(t, ok)
+	require.Equal(t, "int16", cast.Type.Value)
+	require.Equal(t, "cast int16", cast.String())
+	require.Equal(t, "cast bigdecimal", pg.Statements[1].String())
+	require.Equal(t, token.Position{Line: 2, Column: 1}, pg.Statements[1].Pos())
+
+	for _, input := range []string{"cast", "cast int64", "cast x", "cast int8(1)", "cast int8 int16"} {
+		_, err := NewParser(input).ParseProgram()
+		require.Error(t, err, input)
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	input := `; header comment
+push int32(33)
+
+push int8(2) ; trailing comment
+	add
+dump
+exit`
+
+	p, err := NewParserFromReader(strings.NewReader(input))
+	require.NoError(t, err)
+	program, err := p.ParseProgram()
+	require.NoError(t, err)
+
+	tests := []struct {
+		literal string
+		want    ast.Statement
+		pos     token.Position
+	}{
+		{"push", &ast.PushStatement{}, token.Position{Line: 2, Column: 1}},
+		{"push", &ast.PushStatement{}, token.Position{Line: 4, Column: 1}},
+		{"add", &ast.AddStatement{}, token.Position{Line: 5, Column: 2}},
+		{"dump", &ast.DumpStatement{}, token.Position{Line: 6, Column: 1}},
+		{"exit", &ast.ExitStatement{}, token.Position{Line: 7, Column: 1}},
+	}
+
+	require.Len(t, program.Statements, len(tests))
+	for i, tt := range tests {
+		stmt := program.Statements[i]
+		require.IsType(t, tt.want, stmt)
+		require.Equal(t, tt.literal, stmt.TokenLiteral())
+		require.Equal(t, tt.pos, stmt.Pos())
+	}
+}
+
+func TestParseProgramErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   token.Position
+	}{
+		{"push int8(1) pop", token.Position{Line: 1, Column: 14}},
+		{"push int8(1)\npop pop", token.Position{Line: 2, Column: 5}},
+		{"push int8(1\n)", token.Position{Line: 1, Column: 11}},
+	}
+
+	for _, tt := range tests {
+		_, err := NewParser(tt.input).ParseProgram()
+		require.Error(t, err, tt.input)
+		pErr, ok := err.(*ParseError)
+		require.True(t, ok)
+		require.Equal(t, tt.pos, pErr.Pos)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	program, err := ParseFile("../f.avm")
+	require.NoError(t, err)
+	require.NotEmpty(t, program.Statements)
+
+	stmt := program.Statements[0]
+	require.Equal(t, token.Position{Filename: "../f.avm", Line: 4, Column: 1}, stmt.Pos())
+	require.Equal(t, "../f.avm:4:1", stmt.Pos().String())
+
+	_, err = ParseFile("test.avm")
+	require.Error(t, err)
+}
+
 func TestAssertStatement(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -302,6 +516,12 @@ func TestPushStatements(t *testing.T) {
 		{"push int32(42)", "int32", int32(42), false},
 		{"push float(42.42)", "float", float32(42.42), false},
 		{"push double(42.42)", "double", 42.42, false},
+		{"push bigdecimal(42.42)", "bigdecimal", big.NewRat(4242, 100), false},
+		{"push int8(-128)", "int8", int8(-128), false},
+		{"push int32(-42)", "int32", int32(-42), false},
+		{"push double(-42.42)", "double", -42.42, false},
+		{"push int8(128)", "int8", nil, true},
+		{"push int8(-129)", "int8", nil, true},
 		{"push ", "double", 42.42, true},
 	}
 	
@@ -393,6 +613,8 @@ func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{
 		return testFloatLiteral(t, exp, v)
 	case float64:
 		return testDoubleLiteral(t, exp, v)
+	case *big.Rat:
+		return testBigDecimalLiteral(t, exp, v)
 	case string:
 		return testIdentifier(t, exp, v)
 	}
@@ -458,3 +680,12 @@ func testDoubleLiteral(t *testing.T, fl ast.Expression, v float64) bool {
 	require.Equal(t, doubleLit.TokenLiteral(), lit)
 	return true
 }
+
+func testBigDecimalLiteral(t *testing.T, dl ast.Expression, v *big.Rat) bool {
+	decimalLit, ok := dl.(*ast.BigDecimalLiteral)
+	require.True(t, ok)
+
+	require.Zero(t, decimalLit.DecimalValue.Cmp(v))
+	require.Equal(t, decimalLit.TokenLiteral(), v.FloatString(2))
+	return true
+}
@@ -1,49 +1,60 @@
 package reader
 
 import (
+	"avm/bytecode"
 	"avm/evaluator"
 	"avm/parser"
-	"bufio"
-	"fmt"
-	"os"
+	"context"
+	"errors"
+	"io"
 	"strings"
 )
 
-// ReadFile read instructions from a file.
-func ReadFile(filename string) error {
-	f, err := os.Open(filename)
-	if err != nil {
+// ReadFile read instructions from a file, either source code or a program
+// compiled to a .avmc file. The output of the instructions is written to w.
+func ReadFile(filename string, w io.Writer) error {
+	return ReadFileContext(context.Background(), filename, w)
+}
+
+// ReadFileContext is like ReadFile but stops the program when ctx is done.
+func ReadFileContext(ctx context.Context, filename string, w io.Writer) error {
+	vm := evaluator.NewVM(evaluator.NewStack())
+	vm.Stdout = w
+	return RunFile(ctx, vm, filename)
+}
+
+// RunFile evaluates the program of a source or compiled file on vm, which
+// can be configured beforehand, e.g. to trace the instructions. The stack is
+// dumped to vm.Stdout at the end of the program unless it exits.
+func RunFile(ctx context.Context, vm *evaluator.VM, filename string) error {
+	if err := run(ctx, vm, filename); err != nil {
+		if errors.Is(err, evaluator.ErrExit) {
+			return nil
+		}
+
 		return err
 	}
-	defer f.Close()
-	
-	st := evaluator.NewStack()
-	
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-		p := parser.NewParser(line)
-		pg, pErr := p.ParseInstruction()
-		if pErr != nil {
-			_, _ = fmt.Fprintf(os.Stderr, pErr.Error())
-			continue
-		}
 
-		if pg == nil {
-			continue
-		}
-		
-		if _, err = st.Eval(pg); err != nil {
+	return vm.Stack.Dump(vm.Stdout)
+}
+
+// run evaluates a source file, or runs the instructions of a compiled one.
+func run(ctx context.Context, vm *evaluator.VM, filename string) error {
+	if !strings.HasSuffix(filename, ".avmc") {
+		pg, err := parser.ParseFile(filename)
+		if err != nil {
 			return err
 		}
-	}
 
-	if err = scanner.Err(); err != nil {
+		_, err = vm.EvalContext(ctx, pg)
 		return err
 	}
 
-	_, _ = st.Dump()
+	prog, err := bytecode.ReadFile(filename)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	_, err = vm.RunCode(ctx, prog.Executable())
+	return err
 }
@@ -1,7 +1,13 @@
 package reader
 
 import (
+	"avm/bytecode"
+	"avm/parser"
+	"bytes"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -18,7 +24,7 @@ func TestReadFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run("files test", func(t *testing.T) {
-			err := ReadFile(tt.file)
+			err := ReadFile(tt.file, ioutil.Discard)
 			if tt.fails {
 				require.Error(t, err)
 				return
@@ -28,3 +34,25 @@ func TestReadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestReadCompiledFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pg, err := parser.ParseFile("../f.avm")
+	require.NoError(t, err)
+
+	prog, err := bytecode.Compile(pg)
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "f.avmc")
+	require.NoError(t, prog.WriteFile(filename))
+
+	var out bytes.Buffer
+	require.NoError(t, ReadFile(filename, &out))
+	require.Equal(t, "{42 int32}\n{42.42 double}\n{3341.25 float}\n\n", out.String())
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("push int8(1)"), 0644))
+	require.Equal(t, bytecode.ErrBadMagic, ReadFile(filename, ioutil.Discard))
+}
@@ -1,11 +1,31 @@
 package token
 
+import "fmt"
+
 // TokenType type of tokens.
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is the location of a token in the source.
+type Position struct {
+	Filename string // filename, if any
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1
+}
+
+// String returns the position as file:line:column, or line:column when the
+// filename is unknown.
+func (p Position) String() string {
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -15,6 +35,7 @@ const (
 
 	// Delimiters
 	SEMICOLON = ";"
+	COLON     = ":"
 	LPAREN    = "("
 	RPAREN    = ")"
 	LF        = "\n"
@@ -38,6 +59,51 @@ const (
 	MOD    = "mod"
 	PRINT  = "print"
 	EXIT   = "exit"
+	JMP    = "jmp"
+	JZ     = "jz"
+	JNZ    = "jnz"
+	JLT    = "jlt"
+	JGT    = "jgt"
+	CALL   = "call"
+	RET    = "ret"
+	STORE  = "store"
+	LOAD   = "load"
+	CAST   = "cast"
+	OVER   = "over"
+	ROT    = "rot"
+	PICK   = "pick"
+	ROLL   = "roll"
+	DROP   = "drop"
+	DEPTH  = "depth"
+
+	// math
+	NEG  = "neg"
+	ABS  = "abs"
+	MIN  = "min"
+	MAX  = "max"
+	POW  = "pow"
+	SQRT = "sqrt"
+	EXP  = "exp"
+	LOG  = "log"
+	SIN  = "sin"
+	COS  = "cos"
+
+	// bitwise
+	AND = "and"
+	OR  = "or"
+	XOR = "xor"
+	NOT = "not"
+	SHL = "shl"
+	SHR = "shr"
+	SAR = "sar"
+
+	// comparisons, named after the operators they implement
+	CMPEQ  = "eq"
+	CMPNEQ = "neq"
+	CMPLT  = "lt"
+	CMPLE  = "le"
+	CMPGT  = "gt"
+	CMPGE  = "ge"
 
 	// TYPES
 	INT8    = "int8"
@@ -48,6 +114,8 @@ const (
 	FLOAT64 = "float64"
 	DOUBLE  = "double"
 
+	BIGDECIMAL = "bigdecimal"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -76,11 +144,52 @@ var keywords = map[string]TokenType{
 	"exit":   EXIT,
 	"mod":    MOD,
 	"print":  PRINT,
+	"jmp":    JMP,
+	"jz":     JZ,
+	"jnz":    JNZ,
+	"jlt":    JLT,
+	"jgt":    JGT,
+	"call":   CALL,
+	"ret":    RET,
+	"store":  STORE,
+	"load":   LOAD,
+	"cast":   CAST,
+	"over":   OVER,
+	"rot":    ROT,
+	"pick":   PICK,
+	"roll":   ROLL,
+	"drop":   DROP,
+	"depth":  DEPTH,
+	"neg":    NEG,
+	"abs":    ABS,
+	"min":    MIN,
+	"max":    MAX,
+	"pow":    POW,
+	"sqrt":   SQRT,
+	"exp":    EXP,
+	"log":    LOG,
+	"sin":    SIN,
+	"cos":    COS,
+	"and":    AND,
+	"or":     OR,
+	"xor":    XOR,
+	"not":    NOT,
+	"shl":    SHL,
+	"shr":    SHR,
+	"sar":    SAR,
+	"eq":     CMPEQ,
+	"neq":    CMPNEQ,
+	"lt":     CMPLT,
+	"le":     CMPLE,
+	"gt":     CMPGT,
+	"ge":     CMPGE,
 	"int8":   INT8,
 	"int16":  INT16,
 	"int32":  INT32,
 	"float":  FLOAT,
 	"double": DOUBLE,
+
+	"bigdecimal": BIGDECIMAL,
 }
 
 // LookupIdent returns the TokenType associated with the ident keywords.